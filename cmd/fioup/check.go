@@ -6,6 +6,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/foundriesio/fioup/pkg/api"
 	"github.com/foundriesio/fioup/pkg/state"
@@ -65,20 +69,31 @@ type (
 		Description    string `json:"description,omitempty"`
 	}
 
+	// checkTarget adds the selected fields of the target custom metadata to the target
+	checkTarget struct {
+		target.Target
+		Tags      []string          `json:"tags,omitempty"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		CreatedAt *time.Time        `json:"created_at,omitempty"`
+	}
+
 	CheckResult struct {
 		AppsAreInSync  bool              `json:"apps_are_in_sync"`
+		UnhealthyApps  []string          `json:"unhealthy_apps,omitempty"`
 		UpdateRequired bool              `json:"update_required"`
 		Update         CheckResultUpdate `json:"update,omitempty"`
 	}
 )
 
 func printJsonResult(targets target.Targets, currentStatus *status.CurrentStatus) {
-	var areAppsInSync = true
+	areAppsInSync := currentStatus.AreAppsHealthy()
+	var unhealthyApps []string
 	for _, app := range currentStatus.AppStatuses {
-		if !app.Fetched || !app.Installed || !app.Running {
-			areAppsInSync = false
+		if !app.IsInSync() {
+			unhealthyApps = append(unhealthyApps, app.Name)
 		}
 	}
+	slices.Sort(unhealthyApps)
 
 	description := ""
 	var updateType state.UpdateType
@@ -96,15 +111,25 @@ func printJsonResult(targets target.Targets, currentStatus *status.CurrentStatus
 		updateType = state.UpdateTypeSync
 	}
 
+	checkTargets := make([]checkTarget, 0, len(targets))
+	for _, t := range targets {
+		ct := checkTarget{Target: t, Tags: t.Tags(), Labels: t.Labels()}
+		if createdAt := t.CreatedAt(); !createdAt.IsZero() {
+			ct.CreatedAt = &createdAt
+		}
+		checkTargets = append(checkTargets, ct)
+	}
+
 	result := struct {
-		Targets       target.Targets        `json:"targets"`
+		Targets       []checkTarget         `json:"targets"`
 		CurrentStatus *status.CurrentStatus `json:"current_status"`
 		CheckResult   CheckResult           `json:"check_result"`
 	}{
-		Targets:       targets,
+		Targets:       checkTargets,
 		CurrentStatus: currentStatus,
 		CheckResult: CheckResult{
 			AppsAreInSync:  areAppsInSync,
+			UnhealthyApps:  unhealthyApps,
 			UpdateRequired: updateRequired,
 		},
 	}
@@ -133,6 +158,20 @@ func printJsonResult(targets target.Targets, currentStatus *status.CurrentStatus
 func printTextResult(targets target.Targets, currentStatus *status.CurrentStatus) {
 	for _, t := range targets.GetSortedList() {
 		fmt.Printf("%d [%s]\n", t.Version, t.ID)
+		if createdAt := t.CreatedAt(); !createdAt.IsZero() {
+			fmt.Printf("    created: %s\n", createdAt.Local().Format(time.DateTime))
+		}
+		if tags := t.Tags(); len(tags) > 0 {
+			fmt.Printf("    tags:    %s\n", strings.Join(tags, ", "))
+		}
+		if labels := t.Labels(); len(labels) > 0 {
+			keys := slices.Sorted(maps.Keys(labels))
+			pairs := make([]string, 0, len(keys))
+			for _, key := range keys {
+				pairs = append(pairs, key+"="+labels[key])
+			}
+			fmt.Printf("    labels:  %s\n", strings.Join(pairs, ", "))
+		}
 		for _, app := range t.Apps {
 			fmt.Printf("    %-20s%s\n", app.Name, app.URI)
 		}
@@ -150,7 +189,7 @@ func printTextResult(targets target.Targets, currentStatus *status.CurrentStatus
 		fmt.Println("Status:          Up-to-date (degraded)")
 		fmt.Println("Unhealthy apps:")
 		for _, app := range currentStatus.AppStatuses {
-			if app.Running && app.Installed && app.Fetched {
+			if app.IsInSync() {
 				continue
 			}
 			fmt.Printf(" - %s\n", app.Name)
@@ -34,6 +34,7 @@ type (
 
 		gw        *client.GatewayClient
 		sender    *events.EventSender
+		monitor   *client.AppStatesMonitor
 		configApp *fioconfig.App
 
 		sleepInterval time.Duration
@@ -83,6 +84,9 @@ func (u *updater) reload(reloadConfig bool) {
 	DieNotNil(err, "Failed to create event sender")
 	u.sender.Start()
 
+	u.monitor = client.NewAppStatesMonitor(config, u.gw)
+	u.monitor.Start()
+
 	if u.opts.configEnabled {
 		u.opts.fioconfig.AssertCanExtract()
 		u.configApp, err = fioconfig.NewAppWithConfig(
@@ -141,6 +145,9 @@ func (u *updater) checkForCI(err error) {
 }
 
 func (u *updater) Close() {
+	if u.monitor != nil {
+		u.monitor.Stop()
+	}
 	if u.sender != nil {
 		u.sender.Stop()
 	}
@@ -178,6 +185,9 @@ func (u *updater) checkConfig(ctx context.Context, sigHUP chan os.Signal) {
 }
 
 func (u *updater) checkUpdates(ctx context.Context) (nowait bool, err error) {
+	// The update reports the app states itself once it is done, the transitional states are not reported
+	u.monitor.Suspend()
+	defer u.monitor.Resume()
 	err = api.Update(ctx, config, -1,
 		api.WithGatewayClient(u.gw),
 		api.WithEventSender(u.sender),
@@ -204,5 +214,11 @@ func (u *updater) checkUpdates(ctx context.Context) (nowait bool, err error) {
 	} else if err != nil && !errors.Is(err, state.ErrCheckNoUpdate) {
 		slog.Error("Error during update", "error", err)
 	}
+	stats := u.gw.Stats()
+	slog.Debug("Device Gateway requests", "requests", stats.Requests, "retries", stats.Retries,
+		"failovers", stats.Failovers, "failures", stats.Failures)
+	if err := u.gw.SaveStats(); err != nil {
+		slog.Warn("Failed to save Device Gateway request counters", "error", err)
+	}
 	return
 }
@@ -0,0 +1,171 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/foundriesio/fioup/internal/db"
+	"github.com/foundriesio/fioup/internal/events"
+	"github.com/foundriesio/fioup/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+type (
+	eventsListOptions struct {
+		Format string
+	}
+	eventsPurgeOptions struct {
+		olderThan time.Duration
+	}
+
+	eventInfo struct {
+		ID            string `json:"id"`
+		Sink          string `json:"sink"`
+		Type          string `json:"type"`
+		CorrelationID string `json:"correlation_id"`
+		Target        string `json:"target"`
+		Success       *bool  `json:"success,omitempty"`
+		Attempts      int    `json:"attempts"`
+		QueuedAt      string `json:"queued_at"`
+		Age           string `json:"age"`
+	}
+)
+
+func init() {
+	eventsCmd := &cobra.Command{
+		Use:   "events",
+		Short: "Inspect and manage the local queue of update events",
+		Long: `Inspect and manage the local queue of update events.
+
+Update events are stored in the local database until they are delivered.
+Each configured events sink, e.g. the Device Gateway, has its own queue of events.`,
+		Args: cobra.NoArgs,
+	}
+
+	listOpts := eventsListOptions{}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List events waiting to be sent to the events sinks",
+		Args:  cobra.NoArgs,
+	}
+	listCmd.Flags().StringVar(&listOpts.Format, "format", "text", "Format the output. Values: [text | json]")
+	listCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		switch listOpts.Format {
+		case "text", "json":
+			doEventsList(&listOpts)
+		default:
+			return fmt.Errorf("invalid value for --format: %s (must be text or json)", listOpts.Format)
+		}
+		return nil
+	}
+
+	flushCmd := &cobra.Command{
+		Use:   "flush",
+		Short: "Send queued events to the events sinks now",
+		Run: func(cmd *cobra.Command, args []string) {
+			doEventsFlush(cmd.Context())
+		},
+		Args: cobra.NoArgs,
+		Annotations: map[string]string{
+			lockFlagKey: "true",
+		},
+	}
+
+	purgeOpts := eventsPurgeOptions{}
+	purgeCmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Remove queued events without sending them",
+		Run: func(cmd *cobra.Command, args []string) {
+			doEventsPurge(&purgeOpts)
+		},
+		Args: cobra.NoArgs,
+		Annotations: map[string]string{
+			lockFlagKey: "true",
+		},
+	}
+	purgeCmd.Flags().DurationVar(&purgeOpts.olderThan, "older-than", 0,
+		"Remove events queued earlier than this duration ago, including the ones moved aside after failed deliveries, "+
+			"e.g. 72h. Use 0s to remove all events")
+	cobra.CheckErr(cobra.MarkFlagRequired(purgeCmd.Flags(), "older-than"))
+
+	for _, cmd := range []*cobra.Command{listCmd, flushCmd, purgeCmd} {
+		eventsCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(eventsCmd)
+}
+
+func doEventsList(opts *eventsListOptions) {
+	queued, err := events.ListEvents(config.GetDBPath(), "")
+	DieNotNil(err, "failed to get queued events")
+
+	now := time.Now()
+	infos := make([]eventInfo, 0, len(queued))
+	for _, e := range queued {
+		infos = append(infos, eventInfo{
+			ID:            e.Event.Id,
+			Sink:          e.Sink,
+			Type:          string(e.Event.EventType.Id),
+			CorrelationID: e.Event.Event.CorrelationId,
+			Target:        e.Event.Event.TargetName,
+			Success:       e.Event.Event.Success,
+			Attempts:      e.Attempts,
+			QueuedAt:      e.CreatedAt.UTC().Format(time.RFC3339),
+			Age:           now.Sub(e.CreatedAt).Round(time.Second).String(),
+		})
+	}
+
+	if opts.Format == "json" {
+		b, err := json.Marshal(infos)
+		DieNotNil(err, "failed to marshal events")
+		fmt.Println(string(b))
+		return
+	}
+	if len(infos) == 0 {
+		fmt.Println("No events queued")
+		return
+	}
+	fmt.Printf("%-10s %-26s %-40s %-24s %-8s %-9s %s\n", "SINK", "TYPE", "CORRELATION ID", "TARGET", "SUCCESS", "ATTEMPTS", "AGE")
+	for _, e := range infos {
+		success := "-"
+		if e.Success != nil {
+			success = fmt.Sprintf("%v", *e.Success)
+		}
+		fmt.Printf("%-10s %-26s %-40s %-24s %-8s %-9d %s\n", e.Sink, e.Type, e.CorrelationID, e.Target, success, e.Attempts, e.Age)
+	}
+	fmt.Printf("\nTotal: %d events\n", len(infos))
+}
+
+func doEventsFlush(ctx context.Context) {
+	DieNotNil(db.InitializeDatabase(config.GetDBPath()), "failed to initialize database")
+	gwClient, err := client.NewGatewayClient(config, nil, "")
+	DieNotNil(err, "failed to create gateway client")
+	sender, err := events.NewEventSender(config, gwClient)
+	DieNotNil(err, "failed to create event sender")
+
+	batch := 0
+	err = sender.FlushEvents(ctx, events.WithFlushBatchHandler(func(r events.BatchResult) {
+		batch++
+		fmt.Printf("Batch %d (%s): %d events; delivered: %d, rejected: %d, moved aside: %d",
+			batch, r.Sink, r.Events, r.Delivered, r.Rejected, r.MovedAside)
+		if r.Err != nil {
+			fmt.Printf("; error: %s", r.Err)
+		}
+		fmt.Println()
+	}))
+	if batch == 0 && err == nil {
+		fmt.Println("No events to send")
+	}
+	DieNotNil(err, "failed to flush events")
+}
+
+func doEventsPurge(opts *eventsPurgeOptions) {
+	DieNotNil(db.InitializeDatabase(config.GetDBPath()), "failed to initialize database")
+	removed, err := events.PurgeEvents(config.GetDBPath(), time.Now().Add(-opts.olderThan))
+	DieNotNil(err, "failed to purge events")
+	fmt.Printf("Removed %d events\n", removed)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/foundriesio/fioup/internal/migrate"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	opts := migrate.MigrateOptions{}
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Take over a device updated by aktualizr-lite",
+		Long: `Take over a device updated by aktualizr-lite.
+
+The target recorded as current by aktualizr-lite is registered as the last successful
+update, so the first fioup run syncs the running apps instead of reinstalling them.
+The aktualizr-lite specific [pacman] settings are converted to the fioup ones.
+aktualizr-lite must be stopped before running the migration.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			doMigrate(cmd, &opts)
+		},
+		Args: cobra.NoArgs,
+		Annotations: map[string]string{
+			lockFlagKey: "true",
+		},
+	}
+	cmd.Flags().StringVar(&opts.ConfigDir, "config-dir", migrate.DefaultConfigDir,
+		"Directory to write the converted settings to")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "Show what would be migrated without changing anything")
+	cmd.Flags().BoolVar(&opts.Force, "force", false,
+		"Migrate even if fioup has already completed an update on this device")
+	rootCmd.AddCommand(cmd)
+}
+
+func doMigrate(cmd *cobra.Command, opts *migrate.MigrateOptions) {
+	res, err := migrate.Migrate(cmd.Context(), config, opts)
+	DieNotNil(err, "failed to migrate from aktualizr-lite")
+
+	fmt.Printf("Current target:\t%s\n", res.Target.ID)
+	fmt.Println("Apps:")
+	for _, app := range res.Target.Apps {
+		fmt.Printf("  %s\t%s\n", app.Name, app.URI)
+	}
+	fmt.Printf("Apps fetched: %v, installed: %v, running: %v\n", res.AppsFetched, res.AppsInstalled, res.AppsRunning)
+	if !res.AppsFetched || !res.AppsInstalled || !res.AppsRunning {
+		fmt.Println("The next update will sync the apps of the current target")
+	}
+	if res.ConfigFile != "" {
+		fmt.Printf("Converted settings for %s:\n", res.ConfigFile)
+		for key, value := range res.ConvertedConfig {
+			fmt.Printf("  %s = %q\n", key, value)
+		}
+	}
+	if len(res.UnsupportedKeys) > 0 {
+		fmt.Printf("Settings not supported by fioup: %s\n", strings.Join(res.UnsupportedKeys, ", "))
+	}
+	if opts.DryRun {
+		fmt.Println("Dry run; nothing was changed")
+		return
+	}
+	fmt.Printf("Registered update %s as the last successful update\n", res.Update.ID)
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -25,7 +26,7 @@ func init() {
 			var err error
 			opt.SotaDir, err = filepath.Abs(opt.SotaDir)
 			cobra.CheckErr(err)
-			doRegister(&opt)
+			doRegister(cmd.Context(), &opt)
 		},
 		Annotations: map[string]string{
 			lockFlagKey: "true",
@@ -53,7 +54,7 @@ func init() {
 	rootCmd.AddCommand(cmd)
 }
 
-func doRegister(opts *register.RegisterOptions) {
+func doRegister(ctx context.Context, opts *register.RegisterOptions) {
 	h := oauthHandler{}
 	err := register.RegisterDevice(opts, &h)
 	if err != nil && errors.Is(err, os.ErrExist) {
@@ -71,7 +72,7 @@ func doRegister(opts *register.RegisterOptions) {
 	DieNotNil(err, "failed to create Device Gateway client")
 
 	fmt.Print("Checking connection to Device Gateway and sending device configuration...")
-	DieNotNil(client.PutSysInfo(), "failed to send device configuration and sysinfo to Device Gateway")
+	DieNotNil(client.PutSysInfo(ctx), "failed to send device configuration and sysinfo to Device Gateway")
 	fmt.Println("success")
 }
 
@@ -6,11 +6,15 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/foundriesio/composeapp/pkg/compose"
 	"github.com/foundriesio/composeapp/pkg/update"
+	"github.com/foundriesio/fioup/pkg/client"
 	"github.com/foundriesio/fioup/pkg/status"
+	"github.com/foundriesio/fioup/pkg/target"
 	"github.com/spf13/cobra"
 )
 
@@ -21,6 +25,10 @@ type (
 		CurrentStatus *status.CurrentStatus `json:"current_status"`
 		// Status of a pending or last update operation, if any
 		UpdateStatus *status.UpdateStatus `json:"update_status,omitempty"`
+		// Version of the trusted TUF root metadata, if the device has fetched targets in the TUF mode
+		TufRootVersion int `json:"tuf_root_version,omitempty"`
+		// Counters of the requests made to the Device Gateway by the daemon, if it is running or has run
+		GatewayStats *client.SavedGatewayStats `json:"gateway_stats,omitempty"`
 	}
 	statusOptions struct {
 		Format string
@@ -50,13 +58,19 @@ func init() {
 }
 
 func doStatus(cmd *cobra.Command, opts *statusOptions) {
-	cs, err := status.GetCurrentStatus(cmd.Context(), config.ComposeConfig())
+	cs, err := status.GetCurrentStatus(cmd.Context(), config.ComposeConfig(), status.WithServiceDetails(true))
 	DieNotNil(err, "failed to get current status")
 	us, err := status.GetUpdateStatus(config.ComposeConfig())
 	DieNotNil(err, "failed to get update status")
+	tufRootVersion := max(target.ReadTufMetadataVersions(target.TufMetadataDir).Root, 0)
+	gwStats, err := client.ReadGatewayStats(config)
+	if err != nil {
+		slog.Warn("failed to read Device Gateway request counters", "error", err)
+	}
 
 	if opts.Format == "json" {
-		if b, err := json.Marshal(statusReport{CurrentStatus: cs, UpdateStatus: us}); err != nil {
+		report := statusReport{CurrentStatus: cs, UpdateStatus: us, TufRootVersion: tufRootVersion, GatewayStats: gwStats}
+		if b, err := json.Marshal(report); err != nil {
 			DieNotNil(err, "failed to marshal status report")
 		} else {
 			fmt.Println(string(b))
@@ -67,11 +81,20 @@ func doStatus(cmd *cobra.Command, opts *statusOptions) {
 	fmt.Printf("  Target ID:\t%s\n", cs.TargetID)
 	fmt.Printf("  Update ID:\t%s\n", cs.UpdateID)
 	fmt.Printf("  Completed at:\t%s\n", cs.CompletedAt.Local().Format(time.DateTime))
+	if tufRootVersion > 0 {
+		fmt.Printf("  TUF root:\tversion %d\n", tufRootVersion)
+	}
 	fmt.Println("  Apps:")
 	for _, app := range cs.AppStatuses {
 		fmt.Printf("\t\t[%s]: \n", app.Name)
 		fmt.Printf("\t\t  %s\n", app.URI)
 		fmt.Printf("\t\t  fetched:%v; installed:%v; running:%v\n", app.Fetched, app.Installed, app.Running)
+		if len(app.Services) > 0 {
+			fmt.Printf("\t\t  services:\n")
+			for _, srv := range app.Services {
+				printServiceStatus(&srv)
+			}
+		}
 		fmt.Println()
 	}
 	ongoing := true
@@ -102,4 +125,39 @@ func doStatus(cmd *cobra.Command, opts *statusOptions) {
 	if ongoing {
 		fmt.Printf("  Progress:\t%d\n", us.Progress)
 	}
+	if gwStats != nil {
+		fmt.Printf("Device Gateway requests since %s:\n", gwStats.Since.Local().Format(time.DateTime))
+		fmt.Printf("  Requests:\t%d\n", gwStats.Requests)
+		fmt.Printf("  Retries:\t%d\n", gwStats.Retries)
+		fmt.Printf("  Failovers:\t%d\n", gwStats.Failovers)
+		fmt.Printf("  Failures:\t%d\n", gwStats.Failures)
+		fmt.Printf("  Updated at:\t%s\n", gwStats.UpdatedAt.Local().Format(time.DateTime))
+	}
+}
+
+func printServiceStatus(srv *status.ServiceStatus) {
+	name := srv.Name
+	if name == "" {
+		name = "<unknown>"
+	}
+	fmt.Printf("\t\t    - %s: state:%s", name, srv.State)
+	if srv.Health != "" {
+		fmt.Printf("; health:%s", srv.Health)
+	}
+	if srv.ContainerID != "" {
+		fmt.Printf("; restarts:%d", srv.RestartCount)
+	}
+	if srv.UptimeSeconds > 0 {
+		fmt.Printf("; uptime:%s", srv.Uptime())
+	}
+	if srv.LastExitCode != nil {
+		fmt.Printf("; last exit code:%d", *srv.LastExitCode)
+	}
+	fmt.Println()
+	if srv.ImageDigest != "" {
+		fmt.Printf("\t\t      image: %s\n", srv.ImageDigest)
+	}
+	if len(srv.Ports) > 0 {
+		fmt.Printf("\t\t      ports: %s\n", strings.Join(srv.Ports, ", "))
+	}
 }
@@ -0,0 +1,312 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/foundriesio/composeapp/pkg/compose"
+	"github.com/foundriesio/fioup/pkg/api"
+	"github.com/foundriesio/fioup/pkg/target"
+	"github.com/spf13/cobra"
+)
+
+type (
+	targetsListOptions struct {
+		commonOptions
+		All      bool
+		Format   string
+		Limit    int
+		Versions string
+	}
+	targetsShowOptions struct {
+		commonOptions
+		Format string
+	}
+	targetsHistoryOptions struct {
+		Format string
+	}
+)
+
+func init() {
+	opts := targetsListOptions{}
+	targetsCmd := &cobra.Command{
+		Use:   "targets",
+		Short: "List and inspect the targets available to the device, or the stored targets metadata",
+		Long: `List and inspect the targets available to the device, or the stored targets metadata.
+
+The targets are read from the targets metadata received by the last check for updates;
+no requests are made to the Device Gateway.
+A target is available if it matches the hardware ID, the tags, and the platform architecture of the device.
+Run without a subcommand to list the targets.`,
+		Args: cobra.NoArgs,
+	}
+	addTargetsListFlags(targetsCmd, &opts)
+
+	listOpts := targetsListOptions{}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the targets available to the device",
+		Args:  cobra.NoArgs,
+	}
+	addTargetsListFlags(listCmd, &listOpts)
+
+	showOpts := targetsShowOptions{}
+	showCmd := &cobra.Command{
+		Use:   "show <version>",
+		Short: "Show the details of the target of the given version",
+		Args:  cobra.ExactArgs(1),
+	}
+	showCmd.Flags().StringVar(&showOpts.Format, "format", "text", "Format the output. Values: [text | json]")
+	addCommonOptions(showCmd, &showOpts.commonOptions)
+	showCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if err := checkFormat(showOpts.Format); err != nil {
+			return err
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid target version: %s", args[0])
+		}
+		doTargetsShow(version, &showOpts)
+		return nil
+	}
+
+	historyOpts := targetsHistoryOptions{}
+	historyCmd := &cobra.Command{
+		Use:   "history [<version>]",
+		Short: "List the stored versions of the targets metadata, or print the given version",
+		Long: `List the stored versions of the targets metadata, or print the given version.
+
+The targets metadata received from the Device Gateway is kept along with its previous versions.
+If the current metadata gets corrupted, the latest valid version is used instead.`,
+		Args: cobra.MaximumNArgs(1),
+	}
+	historyCmd.Flags().StringVar(&historyOpts.Format, "format", "text", "Format the output. Values: [text | json]")
+	historyCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if err := checkFormat(historyOpts.Format); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			version, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid targets metadata version: %s", args[0])
+			}
+			doTargetsHistoryShow(version)
+		} else {
+			doTargetsHistory(&historyOpts)
+		}
+		return nil
+	}
+
+	for _, cmd := range []*cobra.Command{listCmd, showCmd, historyCmd} {
+		targetsCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(targetsCmd)
+}
+
+func addTargetsListFlags(cmd *cobra.Command, opts *targetsListOptions) {
+	cmd.Flags().BoolVar(&opts.All, "all", false,
+		"Also list the targets that are not available to the device, and the reason why")
+	cmd.Flags().StringVar(&opts.Format, "format", "text", "Format the output. Values: [text | json]")
+	cmd.Flags().IntVar(&opts.Limit, "limit", 0, "List only the given number of the latest targets")
+	cmd.Flags().StringVar(&opts.Versions, "versions", "",
+		"List only the targets of the given versions. Values: <version> | <from>..<to> | <from>.. | ..<to>")
+	addCommonOptions(cmd, &opts.commonOptions)
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if err := checkFormat(opts.Format); err != nil {
+			return err
+		}
+		minVersion, maxVersion, err := parseVersionRange(opts.Versions)
+		if err != nil {
+			return err
+		}
+		if opts.Limit < 0 {
+			return fmt.Errorf("invalid value for --limit: %d (must not be negative)", opts.Limit)
+		}
+		doTargetsList(opts, minVersion, maxVersion)
+		return nil
+	}
+}
+
+func checkFormat(format string) error {
+	switch format {
+	case "text", "json":
+		return nil
+	default:
+		return fmt.Errorf("invalid value for --format: %s (must be text or json)", format)
+	}
+}
+
+// parseVersionRange parses the range of target versions; -1 means that the range is open at that end
+func parseVersionRange(versions string) (int, int, error) {
+	if versions == "" {
+		return -1, -1, nil
+	}
+	parse := func(s string) (int, error) {
+		if s == "" {
+			return -1, nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			return -1, fmt.Errorf("invalid value for --versions: %s", versions)
+		}
+		return v, nil
+	}
+	from, to, isRange := strings.Cut(versions, "..")
+	if !isRange {
+		if from == "" {
+			return -1, -1, fmt.Errorf("invalid value for --versions: %s", versions)
+		}
+		to = from
+	}
+	minVersion, err := parse(from)
+	if err != nil {
+		return -1, -1, err
+	}
+	maxVersion, err := parse(to)
+	if err != nil {
+		return -1, -1, err
+	}
+	if minVersion >= 0 && maxVersion >= 0 && minVersion > maxVersion {
+		return -1, -1, fmt.Errorf("invalid value for --versions: %s (%d is greater than %d)", versions, minVersion, maxVersion)
+	}
+	return minVersion, maxVersion, nil
+}
+
+// targetMarkers returns the markers of the current, latest, and in-progress target
+func targetMarkers(t *api.TargetInfo) string {
+	var markers []string
+	if t.Current {
+		markers = append(markers, "current")
+	}
+	if t.Latest {
+		markers = append(markers, "latest")
+	}
+	if t.InProgress {
+		markers = append(markers, "in-progress")
+	}
+	return strings.Join(markers, ",")
+}
+
+func doTargetsList(opts *targetsListOptions, minVersion, maxVersion int) {
+	targets, err := api.ListTargets(config, api.WithAllTargets(opts.All),
+		api.WithVersionRange(minVersion, maxVersion), api.WithLimit(opts.Limit), api.WithTargetsTUF(opts.enableTuf))
+	DieNotNil(err, "failed to list targets")
+
+	if opts.Format == "json" {
+		if targets == nil {
+			targets = []api.TargetInfo{}
+		}
+		b, err := json.Marshal(targets)
+		DieNotNil(err, "failed to marshal targets")
+		fmt.Println(string(b))
+		return
+	}
+	if len(targets) == 0 {
+		fmt.Println("No targets found")
+		return
+	}
+	if opts.All {
+		fmt.Printf("%-8s %-40s %-24s %-10s %s\n", "VERSION", "ID", "MARKERS", "AVAILABLE", "REASON")
+	} else {
+		fmt.Printf("%-8s %-40s %-24s %s\n", "VERSION", "ID", "MARKERS", "APPS")
+	}
+	for _, t := range targets {
+		if opts.All {
+			fmt.Printf("%-8d %-40s %-24s %-10v %s\n", t.Version, t.ID, targetMarkers(&t), t.Available, t.Reason)
+		} else {
+			fmt.Printf("%-8d %-40s %-24s %s\n", t.Version, t.ID, targetMarkers(&t), strings.Join(t.AppNames(), ", "))
+		}
+	}
+}
+
+func doTargetsShow(version int, opts *targetsShowOptions) {
+	t, err := api.GetTarget(config, version, api.WithTargetsTUF(opts.enableTuf))
+	DieNotNil(err, "failed to get target")
+
+	if opts.Format == "json" {
+		b, err := json.Marshal(t)
+		DieNotNil(err, "failed to marshal target")
+		fmt.Println(string(b))
+		return
+	}
+	fmt.Printf("ID:\t\t%s\n", t.ID)
+	fmt.Printf("Version:\t%d\n", t.Version)
+	if markers := targetMarkers(t); markers != "" {
+		fmt.Printf("Markers:\t%s\n", markers)
+	}
+	if t.Available {
+		fmt.Println("Available:\tyes")
+	} else {
+		fmt.Printf("Available:\tno, %s\n", t.Reason)
+	}
+	if createdAt := t.CreatedAt(); !createdAt.IsZero() {
+		fmt.Printf("Created at:\t%s\n", createdAt.Local().Format(time.DateTime))
+	}
+	if tags := t.Tags(); len(tags) > 0 {
+		fmt.Printf("Tags:\t\t%s\n", strings.Join(tags, ", "))
+	}
+	if labels := t.Labels(); len(labels) > 0 {
+		fmt.Println("Labels:")
+		for _, key := range slices.Sorted(maps.Keys(labels)) {
+			fmt.Printf("\t\t%s=%s\n", key, labels[key])
+		}
+	}
+	fmt.Printf("Failed updates:\t%d\n", t.FailedAttempts)
+	fmt.Println("Apps:")
+	for _, app := range t.Apps {
+		fmt.Printf("\t\t%-20s%s\n", app.Name, app.URI)
+	}
+	if len(t.Custom) > 0 {
+		var custom bytes.Buffer
+		if err := json.Indent(&custom, t.Custom, "  ", "  "); err == nil {
+			fmt.Printf("Custom:\n  %s\n", custom.String())
+		}
+	}
+}
+
+func newTargetsStore() *target.MetadataStore {
+	return target.NewMetadataStore(config.GetTargetsFilepath(), config.GetTargetsHistorySize())
+}
+
+func doTargetsHistory(opts *targetsHistoryOptions) {
+	stored, err := newTargetsStore().List()
+	DieNotNil(err, "failed to list stored targets metadata")
+
+	if opts.Format == "json" {
+		if stored == nil {
+			stored = []target.StoredMetadata{}
+		}
+		b, err := json.Marshal(stored)
+		DieNotNil(err, "failed to marshal stored targets metadata")
+		fmt.Println(string(b))
+		return
+	}
+	if len(stored) == 0 {
+		fmt.Println("No targets metadata stored")
+		return
+	}
+	fmt.Printf("%-8s %-8s %-6s %-10s %-20s %s\n", "VERSION", "CURRENT", "VALID", "SIZE", "SAVED AT", "PATH")
+	for _, m := range stored {
+		current := ""
+		if m.Current {
+			current = "*"
+		}
+		fmt.Printf("%-8d %-8s %-6v %-10s %-20s %s\n", m.Version, current, m.Valid,
+			compose.FormatBytesInt64(m.Size), m.SavedAt.Local().Format(time.DateTime), m.Path)
+	}
+}
+
+func doTargetsHistoryShow(version int) {
+	data, err := newTargetsStore().Get(version)
+	DieNotNil(err, "failed to get stored targets metadata")
+	fmt.Println(string(data))
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -18,7 +19,7 @@ func init() {
 			if whoamiFormat != "json" && whoamiFormat != "text" {
 				return fmt.Errorf("invalid value for --format: %s (must be text or json)", whoamiFormat)
 			}
-			doWhoAmI()
+			doWhoAmI(cmd.Context())
 			return nil
 		},
 		Args: cobra.NoArgs,
@@ -27,10 +28,10 @@ func init() {
 	rootCmd.AddCommand(cmd)
 }
 
-func doWhoAmI() {
+func doWhoAmI(ctx context.Context) {
 	client, err := client.NewGatewayClient(config, nil, "")
 	cobra.CheckErr(err)
-	self, err := client.Self()
+	self, err := client.Self(ctx)
 	DieNotNil(err)
 	cobra.CheckErr(err)
 	if whoamiFormat == "text" {
@@ -4,21 +4,125 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
 
-	"github.com/foundriesio/fioup/internal/events"
-	"github.com/foundriesio/fioup/internal/targets"
+	_ "modernc.org/sqlite"
 )
 
-func InitializeDatabase(dbFilePath string) error {
-	err := targets.CreateTargetsTable(dbFilePath)
+const (
+	// BusyTimeout is how long a statement waits for a lock held by another connection or process,
+	// e.g. the daemon and a CLI command, before failing with "database is locked"
+	BusyTimeout = 10 * time.Second
+)
+
+var (
+	handlesMutex sync.Mutex
+	handles      = map[string]*sql.DB{}
+)
+
+// Open returns the database handle shared by all users of the database file, opening it on first use.
+// The handle is long-lived, callers must not close it; use Close to release it.
+//
+// The database is switched to the WAL journal mode, so readers do not block the writer, and statements
+// wait up to BusyTimeout for locks held by other processes. Transactions take the write lock when
+// they begin, so a transaction does not fail midway because another process wrote in the meantime.
+// The handle uses a single connection, statements of the process are serialized by the handle.
+func Open(dbFilePath string) (*sql.DB, error) {
+	handlesMutex.Lock()
+	defer handlesMutex.Unlock()
+
+	if db, ok := handles[dbFilePath]; ok {
+		return db, nil
+	}
+	db, err := sql.Open("sqlite", dataSourceName(dbFilePath))
 	if err != nil {
-		return fmt.Errorf("failed to create targets table %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxIdleTime(0)
+	db.SetConnMaxLifetime(0)
+	// sql.Open does not connect, ping to report an invalid path or a failure to switch the journal mode now
+	if err := db.Ping(); err != nil {
+		if closeErr := db.Close(); closeErr != nil {
+			slog.Error("failed to close database", "error", closeErr)
+		}
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	handles[dbFilePath] = db
+	return db, nil
+}
 
-	err = events.CreateEventsTable(dbFilePath)
+// OpenReadOnly opens the database file for reading only, so neither its schema nor its journal mode is changed,
+// e.g. to inspect a database written by aktualizr-lite. Unlike Open, the handle is not shared, the caller closes it.
+func OpenReadOnly(dbFilePath string) (*sql.DB, error) {
+	if _, err := os.Stat(dbFilePath); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout(%d)", dbFilePath, BusyTimeout.Milliseconds()))
 	if err != nil {
-		return fmt.Errorf("failed to create events table %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		if closeErr := db.Close(); closeErr != nil {
+			slog.Error("failed to close database", "error", closeErr)
+		}
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+func dataSourceName(dbFilePath string) string {
+	return fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate",
+		dbFilePath, BusyTimeout.Milliseconds())
+}
+
+// Close closes the shared handle of the database file if it is open
+func Close(dbFilePath string) error {
+	handlesMutex.Lock()
+	defer handlesMutex.Unlock()
+
+	db, ok := handles[dbFilePath]
+	if !ok {
+		return nil
+	}
+	delete(handles, dbFilePath)
+	return db.Close()
+}
+
+// WithTransaction runs fn in a transaction, which is committed if fn succeeds and rolled back otherwise
+func WithTransaction(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			slog.Error("failed to rollback transaction", "error", err)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// InitializeDatabase opens the database and upgrades its schema to the latest version
+func InitializeDatabase(dbFilePath string) error {
+	db, err := Open(dbFilePath)
+	if err != nil {
+		return err
+	}
+
+	if err := migrate(db); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 
 	return nil
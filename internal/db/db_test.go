@@ -0,0 +1,76 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDB(t *testing.T) (string, *sql.DB) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "sql.db")
+	require.Nil(t, InitializeDatabase(dbPath))
+	t.Cleanup(func() {
+		require.Nil(t, Close(dbPath))
+	})
+	db, err := Open(dbPath)
+	require.Nil(t, err)
+	return dbPath, db
+}
+
+func TestOpen_SharedHandleInWALMode(t *testing.T) {
+	dbPath, db := newTestDB(t)
+
+	other, err := Open(dbPath)
+	require.Nil(t, err)
+	require.Same(t, db, other)
+
+	var mode string
+	require.Nil(t, db.QueryRow("PRAGMA journal_mode;").Scan(&mode))
+	require.Equal(t, "wal", mode)
+}
+
+func TestOpen_WaitsForLockOfAnotherProcess(t *testing.T) {
+	dbPath, db := newTestDB(t)
+
+	// A separate handle stands for another process, e.g. the daemon, holding the write lock
+	other, err := sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	defer other.Close()
+	tx, err := other.Begin()
+	require.Nil(t, err)
+	_, err = tx.Exec("INSERT INTO report_events (json_string) VALUES ('{}');")
+	require.Nil(t, err)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = tx.Commit()
+	}()
+
+	_, err = db.Exec("INSERT INTO report_events (json_string) VALUES ('{}');")
+	require.Nil(t, err)
+	var count int
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM report_events;").Scan(&count))
+	require.Equal(t, 2, count)
+}
+
+func TestWithTransaction_RollbackOnError(t *testing.T) {
+	_, db := newTestDB(t)
+
+	err := WithTransaction(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO report_events (json_string) VALUES ('{}');"); err != nil {
+			return err
+		}
+		return errors.New("failed")
+	})
+	require.NotNil(t, err)
+	var count int
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM report_events;").Scan(&count))
+	require.Equal(t, 0, count)
+}
@@ -0,0 +1,237 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type (
+	// migration upgrades the schema to its version. The database may have been created by aktualizr-lite,
+	// which shares sql.db with fioup, or by a fioup release preceding the schema versioning, so migrations
+	// must cope with tables and columns that already exist.
+	migration struct {
+		version     int
+		description string
+		apply       func(tx *sql.Tx) error
+	}
+)
+
+// DefaultEventsSink is the sink of events queued by aktualizr-lite and fioup versions without multiple sinks,
+// it is the Device Gateway sink
+const DefaultEventsSink = "gateway"
+
+// migrations are applied in order, each one in its own transaction. Never change or remove an applied
+// migration, add a new one with the next version instead.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create installed_versions and report_events tables",
+		apply:       createInitialTables,
+	},
+	{
+		version:     2,
+		description: "add delivery bookkeeping columns to report_events",
+		apply:       addEventsBookkeepingColumns,
+	},
+	{
+		version:     3,
+		description: "create report_events_failed table",
+		apply:       createFailedEventsTable,
+	},
+}
+
+// LatestSchemaVersion is the schema version of a database after all migrations are applied
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_version(
+	version INTEGER PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT "",
+	applied_at INTEGER NOT NULL DEFAULT 0
+);`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		// Written by a newer fioup, the migrations are additive so the known part of the schema is still usable
+		slog.Warn("Database schema is newer than supported", "version", current, "supported", LatestSchemaVersion())
+		return nil
+	}
+	return applyMigrations(db, current)
+}
+
+// applyMigrations applies the migrations newer than the given version, each of them in its own transaction
+func applyMigrations(db *sql.DB, current int) error {
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		slog.Debug("Migrating database schema", "version", m.version, "description", m.description)
+		err := WithTransaction(db, func(tx *sql.Tx) error {
+			// Another process, e.g. the daemon and a CLI command started together, may have applied the migration
+			// since the version was read; the transaction holds the write lock, so the version read now is final
+			applied, err := schemaVersion(tx)
+			if err != nil {
+				return err
+			}
+			if applied >= m.version {
+				slog.Debug("Database schema migration is already applied", "version", m.version)
+				return nil
+			}
+			if err := m.apply(tx); err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?);",
+				m.version, m.description, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate database schema to version %d (%s): %w", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+// queryRower is implemented by both sql.DB and sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func schemaVersion(db queryRower) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(version) FROM schema_version;").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get database schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+func createInitialTables(tx *sql.Tx) error {
+	// Same definitions as used by aktualizr-lite
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS installed_versions(
+	id INTEGER PRIMARY KEY,
+	ecu_serial TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	name TEXT NOT NULL,
+	hashes TEXT NOT NULL,
+	length INTEGER NOT NULL DEFAULT 0,
+	correlation_id TEXT NOT NULL DEFAULT "",
+	is_current INTEGER NOT NULL CHECK (is_current IN (0,1)) DEFAULT 0,
+	is_pending INTEGER NOT NULL CHECK (is_pending IN (0,1)) DEFAULT 0,
+	was_installed INTEGER NOT NULL CHECK (was_installed IN (0,1)) DEFAULT 0,
+	custom_meta TEXT NOT NULL DEFAULT ""
+);`)
+	if err != nil {
+		return fmt.Errorf("failed to create installed_versions table: %w", err)
+	}
+	_, err = tx.Exec("CREATE TABLE IF NOT EXISTS report_events(id INTEGER PRIMARY KEY, json_string TEXT NOT NULL);")
+	if err != nil {
+		return fmt.Errorf("failed to create report_events table: %w", err)
+	}
+	return nil
+}
+
+func addEventsBookkeepingColumns(tx *sql.Tx) error {
+	for _, c := range []struct{ name, definition string }{
+		{"attempts", "INTEGER NOT NULL DEFAULT 0"},
+		{"created_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"sink", "TEXT NOT NULL DEFAULT '" + DefaultEventsSink + "'"},
+	} {
+		if err := addColumnIfMissing(tx, "report_events", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+	// Events queued before the "created_at" column was added are considered as created now
+	_, err := tx.Exec("UPDATE report_events SET created_at = ? WHERE created_at = 0;", time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to set creation time of report_events: %w", err)
+	}
+	return nil
+}
+
+func createFailedEventsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS report_events_failed(
+	id INTEGER PRIMARY KEY,
+	json_string TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL DEFAULT 0,
+	failed_at INTEGER NOT NULL DEFAULT 0,
+	reason TEXT NOT NULL DEFAULT ""
+);`)
+	if err != nil {
+		return fmt.Errorf("failed to create report_events_failed table: %w", err)
+	}
+	// The table may have been created by a fioup version that did not support multiple sinks
+	return addColumnIfMissing(tx, "report_events_failed", "sink", "TEXT NOT NULL DEFAULT '"+DefaultEventsSink+"'")
+}
+
+func addColumnIfMissing(tx *sql.Tx, table string, column string, definition string) error {
+	found, err := hasColumn(tx, table, column)
+	if err != nil || found {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s to %s: %w", column, table, err)
+	}
+	return nil
+}
+
+func hasColumn(tx *sql.Tx, table string, column string) (bool, error) {
+	columns, err := TableColumns(tx, table)
+	if err != nil {
+		return false, err
+	}
+	return columns[column], nil
+}
+
+// querier is implemented by both sql.DB and sql.Tx
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// TableColumns returns the names of the columns of the given table, there are none if the table does not exist.
+// It lets the read-only readers handle the schemas preceding the migrations.
+func TableColumns(db querier, table string) (map[string]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s table info: %w", table, err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Error("failed to close rows", "error", closeErr)
+		}
+	}()
+	columns := map[string]bool{}
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defValue   sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defValue, &primaryKey); err != nil {
+			return nil, fmt.Errorf("failed to scan %s table info: %w", table, err)
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over %s table info: %w", table, err)
+	}
+	return columns, nil
+}
@@ -0,0 +1,154 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// Schema of sql.db written by fioup releases preceding the schema versioning
+	legacyFioupSchema = `
+CREATE TABLE installed_versions(
+	id INTEGER PRIMARY KEY,
+	ecu_serial TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	name TEXT NOT NULL,
+	hashes TEXT NOT NULL,
+	length INTEGER NOT NULL DEFAULT 0,
+	correlation_id TEXT NOT NULL DEFAULT "",
+	is_current INTEGER NOT NULL CHECK (is_current IN (0,1)) DEFAULT 0,
+	is_pending INTEGER NOT NULL CHECK (is_pending IN (0,1)) DEFAULT 0,
+	was_installed INTEGER NOT NULL CHECK (was_installed IN (0,1)) DEFAULT 0,
+	custom_meta TEXT NOT NULL DEFAULT ""
+);
+CREATE TABLE report_events(id INTEGER PRIMARY KEY, json_string TEXT NOT NULL);
+`
+	// Subset of the sql.db schema written by aktualizr-lite, it has its own "version" table
+	akliteSchema = legacyFioupSchema + `
+CREATE TABLE version(version INTEGER);
+INSERT INTO version(rowid,version) VALUES(1,24);
+CREATE TABLE device_info(unique_mark INTEGER PRIMARY KEY CHECK (unique_mark = 0), device_id TEXT, is_registered INTEGER NOT NULL DEFAULT 0 CHECK (is_registered IN (0,1)));
+CREATE TABLE ecus(id INTEGER PRIMARY KEY, serial TEXT UNIQUE, hardware_id TEXT NOT NULL, is_primary INTEGER NOT NULL DEFAULT 0 CHECK (is_primary IN (0,1)));
+`
+	legacyData = `
+INSERT INTO installed_versions (ecu_serial, sha256, name, hashes, custom_meta, correlation_id, is_current, was_installed)
+	VALUES ('', 'abc', 'intel-corei7-64-lmp-42', 'sha256:abc', '{"version":"42"}', 'corr-42', 1, 1);
+INSERT INTO report_events (json_string) VALUES ('{"id":"event-1"}');
+`
+)
+
+func newLegacyDB(t *testing.T, schema string) string {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "sql.db")
+	db, err := sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	_, err = db.Exec(schema + legacyData)
+	require.Nil(t, err)
+	require.Nil(t, db.Close())
+	t.Cleanup(func() {
+		require.Nil(t, Close(dbPath))
+	})
+	return dbPath
+}
+
+func requireLatestSchema(t *testing.T, db *sql.DB) {
+	t.Helper()
+	version, err := schemaVersion(db)
+	require.Nil(t, err)
+	require.Equal(t, LatestSchemaVersion(), version)
+
+	// The columns and tables added by migrations are usable
+	_, err = db.Exec("INSERT INTO report_events (sink, json_string, attempts, created_at) VALUES ('file', '{}', 1, 1);")
+	require.Nil(t, err)
+	_, err = db.Exec("INSERT INTO report_events_failed (sink, json_string, reason) VALUES ('file', '{}', 'test');")
+	require.Nil(t, err)
+}
+
+func requireLegacyDataKept(t *testing.T, db *sql.DB) {
+	t.Helper()
+	var name, customMeta string
+	require.Nil(t, db.QueryRow("SELECT name, custom_meta FROM installed_versions WHERE is_current = 1;").Scan(&name, &customMeta))
+	require.Equal(t, "intel-corei7-64-lmp-42", name)
+	require.Equal(t, `{"version":"42"}`, customMeta)
+
+	var sink string
+	var createdAt int64
+	require.Nil(t, db.QueryRow("SELECT sink, created_at FROM report_events WHERE json_string = ?;", `{"id":"event-1"}`).
+		Scan(&sink, &createdAt))
+	require.Equal(t, DefaultEventsSink, sink)
+	require.NotZero(t, createdAt)
+}
+
+func TestMigrate_NewDatabase(t *testing.T) {
+	_, db := newTestDB(t)
+	requireLatestSchema(t, db)
+}
+
+func TestMigrate_LegacyFioupDatabase(t *testing.T) {
+	dbPath := newLegacyDB(t, legacyFioupSchema)
+
+	require.Nil(t, InitializeDatabase(dbPath))
+	db, err := Open(dbPath)
+	require.Nil(t, err)
+	requireLatestSchema(t, db)
+	requireLegacyDataKept(t, db)
+}
+
+func TestMigrate_AkliteDatabase(t *testing.T) {
+	dbPath := newLegacyDB(t, akliteSchema)
+
+	require.Nil(t, InitializeDatabase(dbPath))
+	db, err := Open(dbPath)
+	require.Nil(t, err)
+	requireLatestSchema(t, db)
+	requireLegacyDataKept(t, db)
+
+	// The aktualizr-lite schema version is left untouched
+	var akliteVersion int
+	require.Nil(t, db.QueryRow("SELECT version FROM version;").Scan(&akliteVersion))
+	require.Equal(t, 24, akliteVersion)
+}
+
+func TestMigrate_IsIdempotent(t *testing.T) {
+	dbPath, db := newTestDB(t)
+
+	require.Nil(t, InitializeDatabase(dbPath))
+	var count int
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM schema_version;").Scan(&count))
+	require.Equal(t, len(migrations), count)
+}
+
+func TestMigrate_NewerSchema(t *testing.T) {
+	dbPath, db := newTestDB(t)
+	_, err := db.Exec("INSERT INTO schema_version (version, description) VALUES (?, 'from the future');",
+		LatestSchemaVersion()+1)
+	require.Nil(t, err)
+
+	require.Nil(t, InitializeDatabase(dbPath))
+	version, err := schemaVersion(db)
+	require.Nil(t, err)
+	require.Equal(t, LatestSchemaVersion()+1, version)
+}
+
+func TestMigrate_Concurrent(t *testing.T) {
+	// Processes started together, e.g. the daemon and a CLI command, read the version of a new database
+	// before either of them migrates it
+	dbPath, db := newTestDB(t)
+	other, err := sql.Open("sqlite", dataSourceName(dbPath))
+	require.Nil(t, err)
+	defer func() {
+		require.Nil(t, other.Close())
+	}()
+
+	require.Nil(t, applyMigrations(other, 0))
+	requireLatestSchema(t, other)
+	var count int
+	require.Nil(t, db.QueryRow("SELECT COUNT(*) FROM schema_version;").Scan(&count))
+	require.Equal(t, len(migrations), count)
+}
@@ -6,106 +6,278 @@ package events
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"sync"
+	"os"
+	"strings"
+	"time"
 
 	_ "github.com/foundriesio/composeapp/pkg/compose"
 	_ "github.com/foundriesio/composeapp/pkg/update"
-	_ "modernc.org/sqlite"
+	"github.com/foundriesio/fioup/internal/db"
 )
 
-var dbMutex sync.Mutex
+type (
+	// QueuedEvent is an event stored in the local queue along with its delivery bookkeeping
+	QueuedEvent struct {
+		ID        int
+		Sink      string
+		Attempts  int
+		CreatedAt time.Time
+		Event     DgUpdateEvent
+	}
+)
 
-func CreateEventsTable(dbFilePath string) error {
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
+// SaveEvent adds the event to the queue of each of the given sinks
+func SaveEvent(dbFilePath string, event *DgUpdateEvent, sinks []string) error {
+	sqlDB, err := db.Open(dbFilePath)
+	if err != nil {
+		return err
+	}
 
-	db, err := sql.Open("sqlite", dbFilePath)
+	eventJSON, err := json.Marshal(event)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return fmt.Errorf("failed to marshal event to JSON: %w", err)
 	}
-	defer func() {
-		if closeErr := db.Close(); closeErr != nil {
-			slog.Error("failed to close database", "error", closeErr)
+
+	createdAt := time.Now().Unix()
+	return db.WithTransaction(sqlDB, func(tx *sql.Tx) error {
+		for _, sink := range sinks {
+			_, err := tx.Exec("INSERT INTO report_events (sink, json_string, created_at) VALUES (?, ?, ?);",
+				sink, string(eventJSON), createdAt)
+			if err != nil {
+				return fmt.Errorf("failed to insert event into report_events: %w", err)
+			}
 		}
-	}()
+		return nil
+	})
+}
 
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS report_events(id INTEGER PRIMARY KEY, json_string TEXT NOT NULL);")
+func DeleteEvents(dbFilePath string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	sqlDB, err := db.Open(dbFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to create report_events table: %w", err)
+		return err
+	}
+
+	placeholders, args := inClause(ids)
+	_, err = sqlDB.Exec("DELETE FROM report_events WHERE id IN ("+placeholders+");", args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete event from report_events: %w", err)
 	}
 
 	return nil
 }
 
-func SaveEvent(dbFilePath string, event *DgUpdateEvent) error {
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
-
-	db, err := sql.Open("sqlite", dbFilePath)
+// IncrementEventAttempts increases the number of failed delivery attempts of the given events
+// and moves the events that reached maxAttempts to the report_events_failed table.
+// It returns the number of events moved aside.
+func IncrementEventAttempts(dbFilePath string, ids []int, maxAttempts int, reason string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	sqlDB, err := db.Open(dbFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return 0, err
 	}
-	defer func() {
-		if closeErr := db.Close(); closeErr != nil {
-			slog.Error("failed to close database", "error", closeErr)
+
+	var moved int
+	err = db.WithTransaction(sqlDB, func(tx *sql.Tx) error {
+		placeholders, args := inClause(ids)
+		_, err := tx.Exec("UPDATE report_events SET attempts = attempts + 1 WHERE id IN ("+placeholders+");", args...)
+		if err != nil {
+			return fmt.Errorf("failed to update attempts of report_events: %w", err)
 		}
-	}()
+		if maxAttempts <= 0 {
+			return nil
+		}
+		moved, err = moveEventsToFailed(tx, "attempts >= ?", []any{maxAttempts}, reason)
+		return err
+	})
+	return moved, err
+}
 
-	eventJSON, err := json.Marshal(event)
+func moveEventsToFailed(tx *sql.Tx, where string, args []any, reason string) (int, error) {
+	insertArgs := append([]any{time.Now().Unix(), reason}, args...)
+	_, err := tx.Exec("INSERT INTO report_events_failed (sink, json_string, attempts, created_at, failed_at, reason) "+
+		"SELECT sink, json_string, attempts, created_at, ?, ? FROM report_events WHERE "+where+";", insertArgs...)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event to JSON: %w", err)
+		return 0, fmt.Errorf("failed to copy events to report_events_failed: %w", err)
 	}
-
-	_, err = db.Exec("INSERT INTO report_events (json_string) VALUES (?);", string(eventJSON))
+	res, err := tx.Exec("DELETE FROM report_events WHERE "+where+";", args...)
 	if err != nil {
-		return fmt.Errorf("failed to insert event into report_events: %w", err)
+		return 0, fmt.Errorf("failed to delete failed events from report_events: %w", err)
 	}
-
-	return nil
+	moved, _ := res.RowsAffected()
+	return int(moved), nil
 }
 
-func DeleteEvents(dbFilePath string, maxId int) error {
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
-
-	db, err := sql.Open("sqlite", dbFilePath)
+// PruneEvents removes events older than maxAge and the oldest events beyond maxCount in each sink queue,
+// from both the delivery queue and the failed events table. Events of sinks that are not in the given list
+// are removed as well, since they will never be delivered.
+// Zero or negative maxCount and maxAge disable the corresponding limit.
+// It returns the number of removed events.
+func PruneEvents(dbFilePath string, sinks []string, maxCount int, maxAge time.Duration) (int, error) {
+	sqlDB, err := db.Open(dbFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return 0, err
 	}
-	defer func() {
-		if closeErr := db.Close(); closeErr != nil {
-			slog.Error("failed to close database", "error", closeErr)
+
+	var removed int64
+	err = db.WithTransaction(sqlDB, func(tx *sql.Tx) error {
+		deleteEvents := func(table string, query string, args ...any) error {
+			res, err := tx.Exec("DELETE FROM "+table+" WHERE "+query+";", args...)
+			if err != nil {
+				return fmt.Errorf("failed to prune events in %s: %w", table, err)
+			}
+			n, _ := res.RowsAffected()
+			removed += n
+			return nil
 		}
-	}()
+		placeholders, sinkArgs := inClause(sinks)
+		for _, table := range []string{"report_events", "report_events_failed"} {
+			if err := deleteEvents(table, "sink NOT IN ("+placeholders+")", sinkArgs...); err != nil {
+				return err
+			}
+			if maxAge > 0 {
+				if err := deleteEvents(table, "created_at < ?", time.Now().Add(-maxAge).Unix()); err != nil {
+					return err
+				}
+			}
+			if maxCount > 0 {
+				for _, sink := range sinks {
+					err := deleteEvents(table, "sink = ? AND id NOT IN "+
+						"(SELECT id FROM "+table+" WHERE sink = ? ORDER BY id DESC LIMIT ?)", sink, sink, maxCount)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(removed), nil
+}
 
-	_, err = db.Exec("DELETE FROM report_events WHERE id <= ?;", maxId)
+// PurgeEvents removes events created before the given time from both the delivery queue
+// and the failed events table. The creation time is stored in seconds, so the events created
+// in the same second as the given time are removed too. It returns the number of removed events.
+func PurgeEvents(dbFilePath string, createdBefore time.Time) (int, error) {
+	sqlDB, err := db.Open(dbFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to delete event from report_events: %w", err)
+		return 0, err
 	}
 
-	return nil
+	var removed int64
+	err = db.WithTransaction(sqlDB, func(tx *sql.Tx) error {
+		for _, table := range []string{"report_events", "report_events_failed"} {
+			res, err := tx.Exec("DELETE FROM "+table+" WHERE created_at <= ?;", createdBefore.Unix())
+			if err != nil {
+				return fmt.Errorf("failed to delete events from %s: %w", table, err)
+			}
+			n, _ := res.RowsAffected()
+			removed += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(removed), nil
 }
 
-func GetEvents(dbFilePath string) ([]DgUpdateEvent, int, error) {
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
+// GetEvents returns up to limit events queued for the given sink in the order they were queued.
+// An empty sink name selects events of all sinks, a negative limit returns all events.
+func GetEvents(dbFilePath string, sink string, limit int) ([]QueuedEvent, error) {
+	sqlDB, err := db.Open(dbFilePath)
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := sql.Open("sqlite", dbFilePath)
+	eventsList, malformedIDs, err := selectEvents(sqlDB, sink, limit)
 	if err != nil {
-		return nil, -1, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
+	}
+	if len(malformedIDs) > 0 {
+		slog.Warn("Moving malformed events aside", "count", len(malformedIDs))
+		err := db.WithTransaction(sqlDB, func(tx *sql.Tx) error {
+			placeholders, args := inClause(malformedIDs)
+			_, err := moveEventsToFailed(tx, "id IN ("+placeholders+")", args, "malformed event data")
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return eventsList, nil
+}
+
+// ListEvents returns all events queued for the given sink, or for all sinks if the sink name is empty.
+// Unlike GetEvents, it does not change the database: it is opened read-only, its schema is not upgraded
+// and malformed events are skipped rather than moved aside. No events are returned if there is no database.
+// The events queued by aktualizr-lite, or by fioup before the schema upgrade, are listed as they would be
+// after the upgrade: queued for the Device Gateway, not attempted yet and created now.
+func ListEvents(dbFilePath string, sink string) ([]QueuedEvent, error) {
+	sqlDB, err := db.OpenReadOnly(dbFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 	defer func() {
-		if closeErr := db.Close(); closeErr != nil {
+		if closeErr := sqlDB.Close(); closeErr != nil {
 			slog.Error("failed to close database", "error", closeErr)
 		}
 	}()
 
-	max_events := 6
-	rows, err := db.Query("SELECT id, json_string FROM report_events LIMIT (?);", max_events)
+	columns, err := db.TableColumns(sqlDB, "report_events")
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	table := "report_events"
+	if !columns["sink"] || !columns["attempts"] || !columns["created_at"] {
+		table = fmt.Sprintf("(SELECT id, json_string, %s AS sink, %s AS attempts, %s AS created_at FROM report_events)",
+			columnOr(columns, "sink", "'"+db.DefaultEventsSink+"'"),
+			columnOr(columns, "attempts", "0"),
+			columnOr(columns, "created_at", "CAST(strftime('%s', 'now') AS INTEGER)"))
+	}
+	eventsList, malformedIDs, err := selectEventsFrom(sqlDB, table, sink, -1)
+	if err != nil {
+		return nil, err
+	}
+	if len(malformedIDs) > 0 {
+		slog.Warn("Skipped malformed events", "count", len(malformedIDs))
+	}
+	return eventsList, nil
+}
+
+// columnOr returns the column name if the table has the column, or the expression of its default value otherwise
+func columnOr(columns map[string]bool, column string, defaultValue string) string {
+	if columns[column] {
+		return column
+	}
+	return defaultValue
+}
+
+func selectEvents(db *sql.DB, sink string, limit int) ([]QueuedEvent, []int, error) {
+	return selectEventsFrom(db, "report_events", sink, limit)
+}
+
+func selectEventsFrom(db *sql.DB, table string, sink string, limit int) ([]QueuedEvent, []int, error) {
+	rows, err := db.Query("SELECT id, sink, json_string, attempts, created_at FROM "+table+" "+
+		"WHERE ? = '' OR sink = ? ORDER BY id LIMIT (?);", sink, sink, limit)
 	if err != nil {
-		return nil, -1, fmt.Errorf("failed to select events: %w", err)
+		return nil, nil, fmt.Errorf("failed to select events: %w", err)
 	}
 	defer func() {
 		if closeErr := rows.Close(); closeErr != nil {
@@ -113,29 +285,41 @@ func GetEvents(dbFilePath string) ([]DgUpdateEvent, int, error) {
 		}
 	}()
 
-	maxId := -1
-	var eventsList []DgUpdateEvent
+	var eventsList []QueuedEvent
+	var malformedIDs []int
 	for rows.Next() {
-		var eventData string
-		var id int
-		if err := rows.Scan(&id, &eventData); err != nil {
-			return nil, -1, fmt.Errorf("failed to scan event data: %w", err)
+		var eventData, sinkName string
+		var id, attempts int
+		var createdAt int64
+		if err := rows.Scan(&id, &sinkName, &eventData, &attempts, &createdAt); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan event data: %w", err)
 		}
 
 		var event DgUpdateEvent
 		if err := json.Unmarshal([]byte(eventData), &event); err != nil {
-			return nil, -1, fmt.Errorf("failed to unmarshal event data: %w", err)
+			slog.Error("failed to unmarshal event data", "id", id, "error", err)
+			malformedIDs = append(malformedIDs, id)
+			continue
 		}
-
-		if maxId < id {
-			maxId = id
-		}
-		eventsList = append(eventsList, event)
+		eventsList = append(eventsList, QueuedEvent{
+			ID:        id,
+			Sink:      sinkName,
+			Attempts:  attempts,
+			CreatedAt: time.Unix(createdAt, 0),
+			Event:     event,
+		})
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, -1, fmt.Errorf("error iterating over rows: %w", err)
+		return nil, nil, fmt.Errorf("error iterating over rows: %w", err)
 	}
+	return eventsList, malformedIDs, nil
+}
 
-	return eventsList, maxId, nil
+func inClause[T any](values []T) (string, []any) {
+	args := make([]any, 0, len(values))
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", len(values)), ","), args
 }
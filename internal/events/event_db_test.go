@@ -0,0 +1,287 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package events
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/foundriesio/fioup/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func initTestDB(t *testing.T, dbPath string) {
+	t.Helper()
+	require.Nil(t, db.InitializeDatabase(dbPath))
+	t.Cleanup(func() {
+		require.Nil(t, db.Close(dbPath))
+	})
+}
+
+func newTestEventsDB(t *testing.T, numEvents int) string {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "sql.db")
+	initTestDB(t, dbPath)
+	for i := 0; i < numEvents; i++ {
+		require.Nil(t, SaveEvent(dbPath, &DgUpdateEvent{Id: strconv.Itoa(i)}, []string{GatewaySinkName}))
+	}
+	return dbPath
+}
+
+func TestEventsDB_AttemptsAndFailedEvents(t *testing.T) {
+	dbPath := newTestEventsDB(t, 3)
+
+	evts, err := GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 3)
+
+	// The first event is rejected twice and reaches the limit, the second one is rejected once
+	moved, err := IncrementEventAttempts(dbPath, []int{evts[0].ID, evts[1].ID}, 2, "HTTP_400")
+	require.Nil(t, err)
+	require.Equal(t, 0, moved)
+	moved, err = IncrementEventAttempts(dbPath, []int{evts[0].ID}, 2, "HTTP_400")
+	require.Nil(t, err)
+	require.Equal(t, 1, moved)
+
+	evts, err = GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 2)
+	require.Equal(t, "1", evts[0].Event.Id)
+	require.Equal(t, 1, evts[0].Attempts)
+
+	require.Nil(t, DeleteEvents(dbPath, []int{evts[0].ID}))
+	evts, err = GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 1)
+	require.Equal(t, "2", evts[0].Event.Id)
+}
+
+func TestEventsDB_MalformedEventIsMovedAside(t *testing.T) {
+	dbPath := newTestEventsDB(t, 1)
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	_, err = sqlDB.Exec("INSERT INTO report_events (json_string) VALUES ('{not a json');")
+	require.Nil(t, err)
+	require.Nil(t, sqlDB.Close())
+
+	evts, err := GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 1)
+
+	sqlDB, err = sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	defer sqlDB.Close()
+	var count int
+	require.Nil(t, sqlDB.QueryRow("SELECT COUNT(*) FROM report_events_failed;").Scan(&count))
+	require.Equal(t, 1, count)
+}
+
+func TestEventsDB_ListIsReadOnly(t *testing.T) {
+	dbPath := newTestEventsDB(t, 2)
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	_, err = sqlDB.Exec("INSERT INTO report_events (json_string) VALUES ('{not a json');")
+	require.Nil(t, err)
+	require.Nil(t, sqlDB.Close())
+
+	// The database is closed, so its content is written to the database file
+	require.Nil(t, db.Close(dbPath))
+	before, err := os.ReadFile(dbPath)
+	require.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		evts, err := ListEvents(dbPath, "")
+		require.Nil(t, err)
+		require.Len(t, evts, 2)
+	}
+	after, err := os.ReadFile(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, before, after)
+	evts, err := ListEvents(dbPath, FileSinkName)
+	require.Nil(t, err)
+	require.Empty(t, evts)
+
+	// The malformed event is left in the queue
+	sqlDB, err = sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	defer sqlDB.Close()
+	var queued, failed int
+	require.Nil(t, sqlDB.QueryRow("SELECT COUNT(*) FROM report_events;").Scan(&queued))
+	require.Nil(t, sqlDB.QueryRow("SELECT COUNT(*) FROM report_events_failed;").Scan(&failed))
+	require.Equal(t, 3, queued)
+	require.Equal(t, 0, failed)
+
+	evts, err = ListEvents(filepath.Join(t.TempDir(), "sql.db"), "")
+	require.Nil(t, err)
+	require.Empty(t, evts)
+}
+
+func TestEventsDB_ListLegacySchema(t *testing.T) {
+	// Table as created by aktualizr-lite and older fioup versions, the schema is not upgraded by listing
+	dbPath := filepath.Join(t.TempDir(), "sql.db")
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	_, err = sqlDB.Exec("CREATE TABLE version(version INTEGER);")
+	require.Nil(t, err)
+	require.Nil(t, sqlDB.Close())
+
+	// No events are queued if there is no events table
+	evts, err := ListEvents(dbPath, "")
+	require.Nil(t, err)
+	require.Empty(t, evts)
+
+	sqlDB, err = sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	_, err = sqlDB.Exec("CREATE TABLE report_events(id INTEGER PRIMARY KEY, json_string TEXT NOT NULL);")
+	require.Nil(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO report_events (json_string) VALUES ('{"id":"legacy"}');`)
+	require.Nil(t, err)
+	require.Nil(t, sqlDB.Close())
+	before, err := os.ReadFile(dbPath)
+	require.Nil(t, err)
+
+	evts, err = ListEvents(dbPath, "")
+	require.Nil(t, err)
+	require.Len(t, evts, 1)
+	require.Equal(t, "legacy", evts[0].Event.Id)
+	require.Equal(t, GatewaySinkName, evts[0].Sink)
+	require.Equal(t, 0, evts[0].Attempts)
+	require.False(t, evts[0].CreatedAt.Before(time.Now().Add(-time.Minute)))
+	evts, err = ListEvents(dbPath, FileSinkName)
+	require.Nil(t, err)
+	require.Empty(t, evts)
+
+	after, err := os.ReadFile(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, before, after)
+}
+
+func TestEventsDB_Purge(t *testing.T) {
+	dbPath := newTestEventsDB(t, 4)
+	evts, err := GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	moved, err := IncrementEventAttempts(dbPath, []int{evts[0].ID, evts[1].ID}, 1, "HTTP_400")
+	require.Nil(t, err)
+	require.Equal(t, 2, moved)
+
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	defer sqlDB.Close()
+	old := time.Now().Add(-48 * time.Hour).Unix()
+	_, err = sqlDB.Exec("UPDATE report_events SET created_at = ? WHERE id = ?;", old, evts[2].ID)
+	require.Nil(t, err)
+	_, err = sqlDB.Exec("UPDATE report_events_failed SET created_at = ? WHERE json_string LIKE '%\"id\":\"0\"%';", old)
+	require.Nil(t, err)
+
+	// The old events are removed from both the queue and the failed events
+	removed, err := PurgeEvents(dbPath, time.Now().Add(-24*time.Hour))
+	require.Nil(t, err)
+	require.Equal(t, 2, removed)
+	var failed int
+	require.Nil(t, sqlDB.QueryRow("SELECT COUNT(*) FROM report_events_failed;").Scan(&failed))
+	require.Equal(t, 1, failed)
+	evts, err = GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 1)
+	require.Equal(t, "3", evts[0].Event.Id)
+
+	removed, err = PurgeEvents(dbPath, time.Now().Add(time.Second))
+	require.Nil(t, err)
+	require.Equal(t, 2, removed)
+	require.Nil(t, sqlDB.QueryRow("SELECT COUNT(*) FROM report_events_failed;").Scan(&failed))
+	require.Equal(t, 0, failed)
+}
+
+func TestEventsDB_PurgeCurrentSecond(t *testing.T) {
+	dbPath := newTestEventsDB(t, 2)
+	// The events created in the current second are purged too, e.g. by "fioup events purge --older-than 0s"
+	removed, err := PurgeEvents(dbPath, time.Now())
+	require.Nil(t, err)
+	require.Equal(t, 2, removed)
+	evts, err := GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Empty(t, evts)
+}
+
+func TestEventsDB_Prune(t *testing.T) {
+	dbPath := newTestEventsDB(t, 5)
+
+	removed, err := PruneEvents(dbPath, []string{GatewaySinkName}, 3, 0)
+	require.Nil(t, err)
+	require.Equal(t, 2, removed)
+	evts, err := GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 3)
+	// The oldest events are removed
+	require.Equal(t, "2", evts[0].Event.Id)
+
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	_, err = sqlDB.Exec("UPDATE report_events SET created_at = ? WHERE id = ?;",
+		time.Now().Add(-48*time.Hour).Unix(), evts[0].ID)
+	require.Nil(t, err)
+	require.Nil(t, sqlDB.Close())
+
+	removed, err = PruneEvents(dbPath, []string{GatewaySinkName}, 0, 24*time.Hour)
+	require.Nil(t, err)
+	require.Equal(t, 1, removed)
+	evts, err = GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 2)
+}
+
+func TestEventsDB_UpgradeLegacyTable(t *testing.T) {
+	// Table as created by aktualizr-lite and older fioup versions
+	dbPath := filepath.Join(t.TempDir(), "sql.db")
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	_, err = sqlDB.Exec("CREATE TABLE report_events(id INTEGER PRIMARY KEY, json_string TEXT NOT NULL);")
+	require.Nil(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO report_events (json_string) VALUES ('{"id":"legacy"}');`)
+	require.Nil(t, err)
+	require.Nil(t, sqlDB.Close())
+
+	initTestDB(t, dbPath)
+	evts, err := GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 1)
+	require.Equal(t, "legacy", evts[0].Event.Id)
+	require.Equal(t, 0, evts[0].Attempts)
+	require.False(t, evts[0].CreatedAt.Before(time.Now().Add(-time.Minute)))
+}
+
+func TestEventsDB_SinkQueues(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "sql.db")
+	initTestDB(t, dbPath)
+	sinks := []string{GatewaySinkName, FileSinkName}
+	require.Nil(t, SaveEvent(dbPath, &DgUpdateEvent{Id: "0"}, sinks))
+
+	for _, sink := range sinks {
+		evts, err := GetEvents(dbPath, sink, 10)
+		require.Nil(t, err)
+		require.Len(t, evts, 1)
+		require.Equal(t, sink, evts[0].Sink)
+	}
+
+	// Delivery to one sink does not affect the queue of the other one
+	evts, err := GetEvents(dbPath, FileSinkName, 10)
+	require.Nil(t, err)
+	require.Nil(t, DeleteEvents(dbPath, []int{evts[0].ID}))
+	evts, err = GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 1)
+	require.Equal(t, GatewaySinkName, evts[0].Sink)
+
+	// Events of sinks that are no longer configured are pruned
+	require.Nil(t, SaveEvent(dbPath, &DgUpdateEvent{Id: "1"}, sinks))
+	removed, err := PruneEvents(dbPath, []string{GatewaySinkName}, 0, 0)
+	require.Nil(t, err)
+	require.Equal(t, 1, removed)
+	evts, err = GetEvents(dbPath, "", 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 2)
+}
@@ -4,8 +4,11 @@
 package events
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"strconv"
 	"sync"
 	"time"
@@ -28,22 +31,59 @@ const (
 
 	MaxDetailsSize  = 2048
 	TruncatedSuffix = "...[TRUNCATED]"
+
+	maxEventsPerBatch = 6
+	minFlushBackoff   = 10 * time.Second
+	maxFlushBackoff   = 10 * time.Minute
+	// The final flush made when the sender stops must not delay the shutdown for long
+	finalFlushTimeout = 10 * time.Second
 )
 
 type (
 	EventSender struct {
-		dbPath   string
-		gwClient *client.GatewayClient
+		dbPath string
+		sinks  []*sinkQueue
+
+		maxCount    int
+		maxAge      time.Duration
+		maxAttempts int
 
 		ticker    *time.Ticker
 		stopChan  chan struct{}
 		flushChan chan struct{}
+		// cancel interrupts the periodic flush in progress when the sender stops
+		cancel context.CancelFunc
 
 		wg sync.WaitGroup
 	}
 
+	// sinkQueue tracks the delivery backoff of a sink, each sink is retried independently
+	sinkQueue struct {
+		Sink
+		backoff time.Duration
+		retryAt time.Time
+	}
+
+	EventSenderOptions struct {
+		Sinks []Sink
+	}
+	EventSenderOption func(*EventSenderOptions)
+
 	EventTypeValue string
 
+	// DeliveryError is returned when a sink, e.g. the Device Gateway, responds to an events request with a non-2xx status
+	DeliveryError struct {
+		StatusCode int
+		Response   string
+	}
+
+	// PartialDeliveryError is returned by a sink that failed after delivering the first Delivered events,
+	// so only the remaining events are sent again
+	PartialDeliveryError struct {
+		Delivered int
+		Err       error
+	}
+
 	DgEvent struct {
 		CorrelationId string `json:"correlationId"`
 		Success       *bool  `json:"success"`
@@ -69,6 +109,20 @@ type (
 		Details string
 	}
 	EnqueueEventOption func(*EnqueueEventOptions)
+
+	// BatchResult describes the outcome of sending one batch of queued events
+	BatchResult struct {
+		Sink       string
+		Events     int
+		Delivered  int
+		Rejected   int
+		MovedAside int
+		Err        error
+	}
+	FlushOptions struct {
+		BatchHandler func(BatchResult)
+	}
+	FlushOption func(*FlushOptions)
 )
 
 func WithEventStatus(success bool) EnqueueEventOption {
@@ -83,44 +137,210 @@ func WithEventDetails(details string) EnqueueEventOption {
 	}
 }
 
-func sendEvent(client *client.GatewayClient, event []DgUpdateEvent) error {
-	res, err := client.Post("/events", event)
-	if err != nil {
-		slog.Error("Unable to send event", "error", err)
-	} else if res.StatusCode < 200 || res.StatusCode > 204 {
-		slog.Info("Server could not process event", "http_status", res.StatusCode, "response", res.String(), "event", event)
+func WithFlushBatchHandler(handler func(BatchResult)) FlushOption {
+	return func(opts *FlushOptions) {
+		opts.BatchHandler = handler
+	}
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("server could not process events: HTTP_%d - %s", e.StatusCode, e.Response)
+}
+
+// IsRejected returns true if the server refused the events themselves, so resending them as is will fail again.
+// Server side errors, timeouts and throttling are transient and do not count as a rejection. Neither do
+// authentication and authorization failures, they are caused by the device credentials rather than the events.
+func (e *DeliveryError) IsRejected() bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return e.StatusCode >= 400 && e.StatusCode < 500
+}
+
+func (e *PartialDeliveryError) Error() string {
+	return fmt.Sprintf("delivered %d events before failure: %s", e.Delivered, e.Err)
+}
+
+func (e *PartialDeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// FlushEvents sends all queued events to each sink in batches.
+// Events are removed from a sink queue only after the sink accepted them. If the sink rejects a batch,
+// its events are resent one by one to find those that are rejected; the attempt counter of such events is
+// increased, and they are moved aside once they reach the maximum number of attempts.
+// Delivery to a sink stops at the first failure, leaving the remaining events of the sink queued.
+func (s *EventSender) FlushEvents(ctx context.Context, options ...FlushOption) error {
+	opts := &FlushOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	var err error
+	for _, q := range s.sinks {
+		if flushErr := s.flushSink(ctx, q, opts); flushErr != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", q.Name(), flushErr))
+		}
 	}
 	return err
 }
 
-func FlushEvents(dbFilePath string, client *client.GatewayClient) error {
-	evts, maxId, err := GetEvents(dbFilePath)
-	if err != nil {
-		return fmt.Errorf("error getting events: %w", err)
+func (s *EventSender) flushSink(ctx context.Context, q *sinkQueue, opts *FlushOptions) error {
+	for {
+		evts, err := GetEvents(s.dbPath, q.Name(), maxEventsPerBatch)
+		if err != nil {
+			return fmt.Errorf("error getting events: %w", err)
+		}
+		if len(evts) == 0 {
+			slog.Debug("No events to send", "sink", q.Name())
+			return nil
+		}
+
+		slog.Debug(fmt.Sprintf("Flushing %d events", len(evts)), "sink", q.Name())
+		result := BatchResult{Sink: q.Name(), Events: len(evts)}
+		err = q.Send(ctx, eventsOf(evts))
+		var deliveryErr *DeliveryError
+		var partialErr *PartialDeliveryError
+		if errors.As(err, &partialErr) {
+			// The events delivered before the failure must not be delivered again
+			delivered := evts[:min(max(partialErr.Delivered, 0), len(evts))]
+			if deleteErr := DeleteEvents(s.dbPath, idsOf(delivered)); deleteErr != nil {
+				err = errors.Join(err, deleteErr)
+			} else {
+				result.Delivered = len(delivered)
+			}
+		} else if errors.As(err, &deliveryErr) && deliveryErr.IsRejected() {
+			err = s.sendOneByOne(ctx, q, evts, &result)
+		} else if err == nil {
+			if err = DeleteEvents(s.dbPath, idsOf(evts)); err == nil {
+				result.Delivered = len(evts)
+			}
+		}
+		if opts.BatchHandler != nil {
+			result.Err = err
+			opts.BatchHandler(result)
+		}
+		if err != nil {
+			return fmt.Errorf("error sending events: %w", err)
+		}
+		if len(evts) < maxEventsPerBatch {
+			return nil
+		}
 	}
+}
 
-	if len(evts) == 0 {
-		slog.Debug("No events to send")
-		return nil
+func (s *EventSender) sendOneByOne(ctx context.Context, q *sinkQueue, evts []QueuedEvent, result *BatchResult) error {
+	var delivered, rejected []int
+	var sendErr error
+	var rejectReason string
+	for _, evt := range evts {
+		err := q.Send(ctx, []DgUpdateEvent{evt.Event})
+		var deliveryErr *DeliveryError
+		if errors.As(err, &deliveryErr) && deliveryErr.IsRejected() {
+			slog.Info("Event was rejected", "sink", q.Name(), "id", evt.Event.Id, "type", evt.Event.EventType.Id,
+				"attempts", evt.Attempts+1, "error", err)
+			rejected = append(rejected, evt.ID)
+			rejectReason = err.Error()
+			sendErr = err
+		} else if err != nil {
+			// Transient failure, keep the rest of events queued and retry later
+			sendErr = err
+			break
+		} else {
+			delivered = append(delivered, evt.ID)
+		}
+	}
+	if err := DeleteEvents(s.dbPath, delivered); err != nil {
+		return err
+	}
+	result.Delivered = len(delivered)
+	result.Rejected = len(rejected)
+	if len(rejected) > 0 {
+		moved, err := IncrementEventAttempts(s.dbPath, rejected, s.maxAttempts, rejectReason)
+		if err != nil {
+			return err
+		}
+		result.MovedAside = moved
+		if moved > 0 {
+			slog.Warn("Moved rejected events aside", "sink", q.Name(), "count", moved, "max_attempts", s.maxAttempts)
+		}
 	}
+	return sendErr
+}
 
-	slog.Debug(fmt.Sprintf("Flushing %d events", len(evts)))
-	err = sendEvent(client, evts)
-	if err != nil {
-		return fmt.Errorf("error sending events: %w", err)
+// flush flushes events of each sink unless a previous failure of the sink requires to wait before the next attempt.
+// The force flag ignores the wait time, it is used for the final flush when the sender stops.
+func (s *EventSender) flush(ctx context.Context, force bool) {
+	for _, q := range s.sinks {
+		if !force && time.Now().Before(q.retryAt) {
+			slog.Debug("Postponing events flush after a failure", "sink", q.Name(),
+				"retry_at", q.retryAt.Format(time.TimeOnly))
+			continue
+		}
+		if err := s.flushSink(ctx, q, &FlushOptions{}); err != nil {
+			if q.backoff == 0 {
+				q.backoff = minFlushBackoff
+			} else {
+				q.backoff = min(q.backoff*2, maxFlushBackoff)
+			}
+			q.retryAt = time.Now().Add(q.backoff)
+			slog.Error("Error flushing events", "sink", q.Name(), "error", err, "retry_in", q.backoff)
+			continue
+		}
+		q.backoff = 0
+		q.retryAt = time.Time{}
 	}
+}
 
-	err = DeleteEvents(dbFilePath, maxId)
-	if err != nil {
-		return fmt.Errorf("error deleting events: %w", err)
+func (s *EventSender) sinkNames() []string {
+	names := make([]string, 0, len(s.sinks))
+	for _, q := range s.sinks {
+		names = append(names, q.Name())
 	}
-	return nil
+	return names
 }
 
-func NewEventSender(cfg *config.Config, gwClient *client.GatewayClient) (*EventSender, error) {
+func eventsOf(evts []QueuedEvent) []DgUpdateEvent {
+	res := make([]DgUpdateEvent, 0, len(evts))
+	for _, evt := range evts {
+		res = append(res, evt.Event)
+	}
+	return res
+}
+
+func idsOf(evts []QueuedEvent) []int {
+	res := make([]int, 0, len(evts))
+	for _, evt := range evts {
+		res = append(res, evt.ID)
+	}
+	return res
+}
+
+// WithEventSinks adds sinks to the ones configured in the TOML config
+func WithEventSinks(sinks ...Sink) EventSenderOption {
+	return func(opts *EventSenderOptions) {
+		opts.Sinks = append(opts.Sinks, sinks...)
+	}
+}
+
+func NewEventSender(cfg *config.Config, gwClient *client.GatewayClient, options ...EventSenderOption) (*EventSender, error) {
+	opts := &EventSenderOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
 	eventSender := &EventSender{
-		dbPath:   cfg.GetDBPath(),
-		gwClient: gwClient,
+		dbPath:      cfg.GetDBPath(),
+		maxCount:    cfg.GetEventsMaxCount(),
+		maxAge:      cfg.GetEventsMaxAge(),
+		maxAttempts: cfg.GetEventsMaxAttempts(),
+	}
+	names := map[string]bool{}
+	for _, sink := range append(sinksFromConfig(cfg, gwClient), opts.Sinks...) {
+		if names[sink.Name()] {
+			return nil, fmt.Errorf("duplicate events sink name: %s", sink.Name())
+		}
+		names[sink.Name()] = true
+		eventSender.sinks = append(eventSender.sinks, &sinkQueue{Sink: sink})
 	}
 
 	return eventSender, nil
@@ -133,6 +353,8 @@ func (s *EventSender) Start() {
 	}
 	s.stopChan = make(chan struct{}, 1)
 	s.flushChan = make(chan struct{}, 1)
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
 	s.wg.Add(1)
 	s.ticker = time.NewTicker(time.Duration(time.Second * 10))
 	go func(stopChan chan struct{}, flushChan chan struct{}) {
@@ -141,17 +363,14 @@ func (s *EventSender) Start() {
 		for {
 			select {
 			case <-stopChan:
+				finalCtx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+				s.flush(finalCtx, true)
+				cancel()
 				return
 			case <-flushChan:
-				err := FlushEvents(s.dbPath, s.gwClient)
-				if err != nil {
-					slog.Error("Error flushing events", "error", err)
-				}
+				s.flush(ctx, false)
 			case <-s.ticker.C:
-				err := FlushEvents(s.dbPath, s.gwClient)
-				if err != nil {
-					slog.Error("Error flushing events", "error", err)
-				}
+				s.flush(ctx, false)
 			}
 		}
 	}(s.stopChan, s.flushChan)
@@ -162,7 +381,7 @@ func (s *EventSender) Stop() {
 	if s.ticker == nil {
 		return
 	}
-	s.flushChan <- struct{}{}
+	s.cancel()
 	s.stopChan <- struct{}{}
 	s.wg.Wait()
 	s.ticker = nil
@@ -195,10 +414,15 @@ func (s *EventSender) EnqueueEvent(eventType EventTypeValue, updateID string, to
 			Id:      eventType,
 			Version: 0x2, // Define event version as 0x2 to distinguish from events sent by older agents
 		},
-	})
+	}, s.sinkNames())
 	if err != nil {
 		return fmt.Errorf("error saving event: %w", err)
 	}
+	if removed, err := PruneEvents(s.dbPath, s.sinkNames(), s.maxCount, s.maxAge); err != nil {
+		slog.Error("Error pruning events queue", "error", err)
+	} else if removed > 0 {
+		slog.Warn("Pruned events queue", "removed", removed, "max_count", s.maxCount, "max_age", s.maxAge)
+	}
 	s.FlushEventsAsync()
 	return nil
 }
@@ -208,5 +432,9 @@ func (s *EventSender) FlushEventsAsync() {
 		slog.Error("Requested events flush on stopped sender")
 		return
 	}
-	s.flushChan <- struct{}{}
+	select {
+	case s.flushChan <- struct{}{}:
+	default:
+		// A flush is already pending
+	}
 }
@@ -0,0 +1,27 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package events
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliveryError_IsRejected(t *testing.T) {
+	for status, rejected := range map[int]bool{
+		http.StatusBadRequest:            true,
+		http.StatusRequestEntityTooLarge: true,
+		http.StatusUnprocessableEntity:   true,
+		http.StatusUnauthorized:          false,
+		http.StatusForbidden:             false,
+		http.StatusRequestTimeout:        false,
+		http.StatusTooManyRequests:       false,
+		http.StatusInternalServerError:   false,
+		http.StatusServiceUnavailable:    false,
+	} {
+		require.Equal(t, rejected, (&DeliveryError{StatusCode: status}).IsRejected(), status)
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// mqttSink publishes events to a local MQTT broker. It implements the minimal subset of MQTT 3.1.1
+// required to publish messages with QoS 1 over plain TCP, so the broker acknowledges each delivered event.
+type mqttSink struct {
+	address  string
+	topic    string
+	clientID string
+	timeout  time.Duration
+}
+
+const (
+	mqttDefaultPort = "1883"
+
+	mqttPacketConnect    byte = 0x10
+	mqttPacketConnAck    byte = 0x20
+	mqttPacketPublishQoS byte = 0x32
+	mqttPacketPubAck     byte = 0x40
+	mqttPacketDisconnect byte = 0xe0
+
+	mqttProtocolLevel  = 4
+	mqttCleanSession   = 0x02
+	mqttKeepAliveSec   = 30
+	mqttMaxRemainingLn = 268435455
+)
+
+// NewMQTTSink returns a sink that publishes each event as a separate message to the given topic.
+// The broker address is either "host[:port]" or "tcp://host[:port]"/"mqtt://host[:port]".
+func NewMQTTSink(broker string, topic string) Sink {
+	address := broker
+	if u, err := url.Parse(broker); err == nil && u.Host != "" {
+		address = u.Host
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, mqttDefaultPort)
+	}
+	hostname, _ := os.Hostname()
+	return &mqttSink{
+		address:  address,
+		topic:    topic,
+		clientID: fmt.Sprintf("fioup-%s-%d", hostname, os.Getpid()),
+		timeout:  10 * time.Second,
+	}
+}
+
+func (s *mqttSink) Name() string { return MQTTSinkName }
+func (s *mqttSink) Send(ctx context.Context, events []DgUpdateEvent) error {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("unable to connect to MQTT broker: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	deadline := time.Now().Add(s.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+	if err := s.connect(conn, r); err != nil {
+		return err
+	}
+	for i, event := range events {
+		payload, err := json.Marshal(event)
+		if err == nil {
+			err = s.publish(conn, r, uint16(i+1), payload)
+		} else {
+			err = fmt.Errorf("failed to marshal event: %w", err)
+		}
+		if err != nil && i > 0 {
+			// The broker has acknowledged the previous events, they must not be published again
+			return &PartialDeliveryError{Delivered: i, Err: err}
+		} else if err != nil {
+			return err
+		}
+	}
+	// All events are acknowledged, a failure to disconnect gracefully does not affect their delivery
+	if _, err = conn.Write([]byte{mqttPacketDisconnect, 0}); err != nil {
+		slog.Debug("failed to disconnect from MQTT broker", "error", err)
+	}
+	return nil
+}
+
+func (s *mqttSink) connect(w io.Writer, r *bufio.Reader) error {
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	body = append(body, mqttProtocolLevel, mqttCleanSession)
+	body = binary.BigEndian.AppendUint16(body, mqttKeepAliveSec)
+	body = appendMQTTString(body, s.clientID)
+	if err := writeMQTTPacket(w, mqttPacketConnect, body); err != nil {
+		return fmt.Errorf("failed to send MQTT connect: %w", err)
+	}
+	packetType, resp, err := readMQTTPacket(r)
+	if err != nil {
+		return fmt.Errorf("failed to read MQTT connect acknowledgment: %w", err)
+	}
+	if packetType != mqttPacketConnAck || len(resp) != 2 {
+		return fmt.Errorf("unexpected MQTT packet 0x%x in response to connect", packetType)
+	}
+	if resp[1] != 0 {
+		return fmt.Errorf("MQTT broker refused connection, return code %d", resp[1])
+	}
+	return nil
+}
+
+func (s *mqttSink) publish(w io.Writer, r *bufio.Reader, packetID uint16, payload []byte) error {
+	var body []byte
+	body = appendMQTTString(body, s.topic)
+	body = binary.BigEndian.AppendUint16(body, packetID)
+	body = append(body, payload...)
+	if err := writeMQTTPacket(w, mqttPacketPublishQoS, body); err != nil {
+		return fmt.Errorf("failed to publish MQTT message: %w", err)
+	}
+	packetType, resp, err := readMQTTPacket(r)
+	if err != nil {
+		return fmt.Errorf("failed to read MQTT publish acknowledgment: %w", err)
+	}
+	if packetType != mqttPacketPubAck || len(resp) != 2 || binary.BigEndian.Uint16(resp) != packetID {
+		return fmt.Errorf("unexpected MQTT packet 0x%x in response to publish", packetType)
+	}
+	return nil
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func writeMQTTPacket(w io.Writer, packetType byte, body []byte) error {
+	if len(body) > mqttMaxRemainingLn {
+		return fmt.Errorf("MQTT packet is too large: %d bytes", len(body))
+	}
+	packet := []byte{packetType}
+	// Remaining length is encoded with 7 bits per byte, the highest bit indicates that more bytes follow
+	for n := len(body); ; {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var length, multiplier int = 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, fmt.Errorf("malformed MQTT remaining length")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeMQTTBroker accepts a single connection, answers the connect with the given return code and
+// acknowledges up to maxAcks published messages before closing the connection.
+// The IDs of the acknowledged events are sent to the returned channel once the connection is closed.
+func newFakeMQTTBroker(t *testing.T, topic string, returnCode byte, maxAcks int) (string, <-chan []string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+	acked := make(chan []string, 1)
+	go func() {
+		var ids []string
+		defer func() {
+			acked <- ids
+		}()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		r := bufio.NewReader(conn)
+		if packetType, _, err := readMQTTPacket(r); err != nil || packetType != mqttPacketConnect {
+			return
+		}
+		if err := writeMQTTPacket(conn, mqttPacketConnAck, []byte{0, returnCode}); err != nil || returnCode != 0 {
+			return
+		}
+		for len(ids) < maxAcks {
+			packetType, body, err := readMQTTPacket(r)
+			if err != nil || packetType != mqttPacketPublishQoS&0xf0 {
+				return
+			}
+			topicLen := int(binary.BigEndian.Uint16(body))
+			if string(body[2:2+topicLen]) != topic {
+				return
+			}
+			packetID := body[2+topicLen : 4+topicLen]
+			var event DgUpdateEvent
+			if err := json.Unmarshal(body[4+topicLen:], &event); err != nil {
+				return
+			}
+			if err := writeMQTTPacket(conn, mqttPacketPubAck, packetID); err != nil {
+				return
+			}
+			ids = append(ids, event.Id)
+		}
+	}()
+	return l.Addr().String(), acked
+}
+
+func newTestEvents(n int) []DgUpdateEvent {
+	var evts []DgUpdateEvent
+	for i := 0; i < n; i++ {
+		evts = append(evts, DgUpdateEvent{Id: strconv.Itoa(i), EventType: DgEventType{Id: DownloadStarted, Version: 2}})
+	}
+	return evts
+}
+
+func TestMQTTSink_Publish(t *testing.T) {
+	address, acked := newFakeMQTTBroker(t, "fioup/events", 0, 10)
+	sink := NewMQTTSink("tcp://"+address, "fioup/events")
+	require.Nil(t, sink.Send(context.Background(), newTestEvents(3)))
+	require.Equal(t, []string{"0", "1", "2"}, <-acked)
+}
+
+func TestMQTTSink_ConnectRefused(t *testing.T) {
+	// Not authorized
+	address, acked := newFakeMQTTBroker(t, "fioup/events", 5, 10)
+	err := NewMQTTSink(address, "fioup/events").Send(context.Background(), newTestEvents(1))
+	require.ErrorContains(t, err, "refused connection, return code 5")
+	require.Empty(t, <-acked)
+
+	// Nothing listens on the address
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	require.Nil(t, l.Close())
+	err = NewMQTTSink(l.Addr().String(), "fioup/events").Send(context.Background(), newTestEvents(1))
+	require.ErrorContains(t, err, "unable to connect to MQTT broker")
+}
+
+func TestMQTTSink_PartialFailure(t *testing.T) {
+	address, acked := newFakeMQTTBroker(t, "fioup/events", 0, 2)
+	err := NewMQTTSink(address, "fioup/events").Send(context.Background(), newTestEvents(3))
+	var partialErr *PartialDeliveryError
+	require.ErrorAs(t, err, &partialErr)
+	require.Equal(t, 2, partialErr.Delivered)
+	require.Equal(t, []string{"0", "1"}, <-acked)
+
+	// The first event is not acknowledged, nothing is delivered
+	address, acked = newFakeMQTTBroker(t, "fioup/events", 0, 0)
+	err = NewMQTTSink(address, "fioup/events").Send(context.Background(), newTestEvents(3))
+	require.NotNil(t, err)
+	require.False(t, errors.As(err, &partialErr))
+	require.Empty(t, <-acked)
+}
+
+func TestEventSender_FlushPartialDelivery(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "sql.db")
+	initTestDB(t, dbPath)
+	for _, evt := range newTestEvents(3) {
+		require.Nil(t, SaveEvent(dbPath, &evt, []string{MQTTSinkName}))
+	}
+	address, acked := newFakeMQTTBroker(t, "fioup/events", 0, 2)
+	sender := &EventSender{dbPath: dbPath, sinks: []*sinkQueue{{Sink: NewMQTTSink(address, "fioup/events")}}}
+
+	var results []BatchResult
+	err := sender.FlushEvents(context.Background(), WithFlushBatchHandler(func(r BatchResult) {
+		results = append(results, r)
+	}))
+	require.NotNil(t, err)
+	require.Equal(t, []string{"0", "1"}, <-acked)
+	require.Len(t, results, 1)
+	require.Equal(t, 2, results[0].Delivered)
+
+	// Only the event that was not acknowledged is sent again
+	evts, err := GetEvents(dbPath, MQTTSinkName, 10)
+	require.Nil(t, err)
+	require.Len(t, evts, 1)
+	require.Equal(t, "2", evts[0].Event.Id)
+	require.Equal(t, 0, evts[0].Attempts)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/foundriesio/fioup/internal/db"
+	"github.com/foundriesio/fioup/pkg/client"
+	"github.com/foundriesio/fioup/pkg/config"
+)
+
+type (
+	// Sink is a destination of update events. Each sink has its own queue of events in the local database,
+	// so a sink that is unavailable does not delay delivery to the other sinks.
+	Sink interface {
+		// Name identifies the sink queue in the database, it must be unique and stable across restarts
+		Name() string
+		// Send delivers the events, the events are removed from the sink queue only if no error is returned.
+		// A *DeliveryError that is rejected (see DeliveryError.IsRejected) counts as a failed attempt of the events.
+		// A *PartialDeliveryError removes the events delivered before the failure from the sink queue.
+		Send(ctx context.Context, events []DgUpdateEvent) error
+	}
+
+	gatewaySink struct {
+		gwClient *client.GatewayClient
+	}
+
+	fileSink struct {
+		path string
+	}
+
+	webhookSink struct {
+		url        string
+		httpClient *http.Client
+	}
+)
+
+const (
+	GatewaySinkName = db.DefaultEventsSink
+	FileSinkName    = "file"
+	WebhookSinkName = "webhook"
+	MQTTSinkName    = "mqtt"
+
+	webhookTimeout = 10 * time.Second
+)
+
+func NewGatewaySink(gwClient *client.GatewayClient) Sink {
+	return &gatewaySink{gwClient: gwClient}
+}
+
+func (s *gatewaySink) Name() string { return GatewaySinkName }
+func (s *gatewaySink) Send(ctx context.Context, events []DgUpdateEvent) error {
+	res, err := s.gwClient.Post(ctx, "/events", events)
+	if err != nil {
+		return fmt.Errorf("unable to send events: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &DeliveryError{StatusCode: res.StatusCode, Response: res.String()}
+	}
+	return nil
+}
+
+// NewFileSink returns a sink that appends events to a file, one JSON document per line
+func NewFileSink(path string) Sink {
+	return &fileSink{path: path}
+}
+
+func (s *fileSink) Name() string { return FileSinkName }
+func (s *fileSink) Send(_ context.Context, events []DgUpdateEvent) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for events file: %w", err)
+	}
+	var data []byte
+	for _, event := range events {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		data = append(append(data, b...), '\n')
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write events file: %w", err)
+	}
+	return nil
+}
+
+// NewWebhookSink returns a sink that posts events as a JSON array to the given URL
+func NewWebhookSink(url string) Sink {
+	return &webhookSink{
+		url:        url,
+		httpClient: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (s *webhookSink) Name() string { return WebhookSinkName }
+func (s *webhookSink) Send(ctx context.Context, events []DgUpdateEvent) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+	// A single attempt is made, the events sender retries failed deliveries with backoff
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unable to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to send events to webhook: %w", err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return &DeliveryError{StatusCode: res.StatusCode, Response: string(body)}
+	}
+	return nil
+}
+
+func sinksFromConfig(cfg *config.Config, gwClient *client.GatewayClient) []Sink {
+	sinks := []Sink{NewGatewaySink(gwClient)}
+	if path := cfg.GetEventsFile(); path != "" {
+		sinks = append(sinks, NewFileSink(path))
+	}
+	if url := cfg.GetEventsWebhookURL(); url != "" {
+		sinks = append(sinks, NewWebhookSink(url))
+	}
+	if broker := cfg.GetEventsMQTTBroker(); broker != "" {
+		sinks = append(sinks, NewMQTTSink(broker, cfg.GetEventsMQTTTopic()))
+	}
+	return sinks
+}
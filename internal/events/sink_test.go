@@ -0,0 +1,68 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events", "events.jsonl")
+	sink := NewFileSink(path)
+	evts := newTestEvents(3)
+	require.Nil(t, sink.Send(context.Background(), evts[:2]))
+	require.Nil(t, sink.Send(context.Background(), evts[2:]))
+
+	f, err := os.Open(path)
+	require.Nil(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	var written []DgUpdateEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var evt DgUpdateEvent
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &evt))
+		written = append(written, evt)
+	}
+	require.Nil(t, scanner.Err())
+	require.Equal(t, evts, written)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received []DgUpdateEvent
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var evts []DgUpdateEvent
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&evts))
+		received = append(received, evts...)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("invalid event"))
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.URL)
+	evts := newTestEvents(2)
+	require.Nil(t, sink.Send(context.Background(), evts))
+	require.Equal(t, evts, received)
+
+	status = http.StatusBadRequest
+	err := sink.Send(context.Background(), evts)
+	var deliveryErr *DeliveryError
+	require.ErrorAs(t, err, &deliveryErr)
+	require.Equal(t, http.StatusBadRequest, deliveryErr.StatusCode)
+	require.Equal(t, "invalid event", deliveryErr.Response)
+	require.True(t, deliveryErr.IsRejected())
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/foundriesio/fioconfig/sotatoml"
+	"github.com/foundriesio/fioup/pkg/config"
+	"github.com/pelletier/go-toml"
+)
+
+var (
+	// renamedKeys maps aktualizr-lite settings to the fioup settings with the same meaning
+	renamedKeys = map[string]string{
+		"pacman.docker_prune": config.ComposeAppsPruneUnusedImagesKey,
+	}
+	// unsupportedKeys are aktualizr-lite settings fioup has no counterpart for
+	unsupportedKeys = []string{
+		"pacman.callback_program",
+		"pacman.create_containers_before_reboot",
+		"pacman.force_update",
+		"pacman.hub_auth_creds_endpoint",
+		"pacman.images_data_root",
+		"pacman.ostree_server",
+		"pacman.packages_file",
+	}
+)
+
+// convertPacmanConfig returns the fioup settings converted from the aktualizr-lite ones,
+// and the aktualizr-lite settings that are not supported by fioup.
+// A fioup setting that is already set is not overridden.
+func convertPacmanConfig(cfg *config.Config) (map[string]string, []string) {
+	tomlConfig := cfg.TomlConfig()
+	converted := map[string]string{}
+	for akliteKey, fioupKey := range renamedKeys {
+		if tomlConfig.Has(akliteKey) && !tomlConfig.Has(fioupKey) {
+			converted[fioupKey] = tomlConfig.Get(akliteKey)
+		}
+	}
+	var unsupported []string
+	for _, key := range unsupportedKeys {
+		if tomlConfig.Has(key) {
+			unsupported = append(unsupported, key)
+		}
+	}
+	slices.Sort(unsupported)
+	return converted, unsupported
+}
+
+func writeConfig(path string, values map[string]string) error {
+	tree, err := toml.TreeFromMap(map[string]any{})
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		tree.Set(key, value)
+	}
+	data, err := tree.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal converted config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := sotatoml.SafeWrite(path, data); err != nil {
+		return fmt.Errorf("failed to write converted config to %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/foundriesio/composeapp/pkg/compose"
+	"github.com/foundriesio/composeapp/pkg/update"
+	"github.com/foundriesio/fioup/internal/db"
+	"github.com/foundriesio/fioup/internal/register"
+	"github.com/foundriesio/fioup/internal/targets"
+	"github.com/foundriesio/fioup/pkg/config"
+	"github.com/foundriesio/fioup/pkg/target"
+)
+
+type (
+	MigrateOptions struct {
+		// ConfigDir is the directory the converted aktualizr-lite settings are written to
+		ConfigDir string
+		// DryRun reports what would be migrated without changing anything
+		DryRun bool
+		// Force seeds the update DB even if fioup has already completed an update on the device
+		Force bool
+	}
+
+	MigrateResult struct {
+		Target          target.Target
+		Update          *update.Update
+		AppsFetched     bool
+		AppsInstalled   bool
+		AppsRunning     bool
+		ConvertedConfig map[string]string
+		UnsupportedKeys []string
+		ConfigFile      string
+	}
+)
+
+const (
+	DefaultConfigDir = "/etc/sota/conf.d"
+	// MigratedConfigFilename is more significant than sota.toml and less significant than the fioctl managed config
+	MigratedConfigFilename = "z-40-fioup-migrated.toml"
+)
+
+var (
+	ErrAlreadyMigrated = errors.New("fioup has already completed an update on this device")
+	ErrNoCurrentTarget = errors.New("no current target found in the aktualizr-lite database")
+	ErrAkliteIsRunning = errors.New("aktualizr-lite is running; stop it before migrating")
+)
+
+// Migrate takes over a device updated by aktualizr-lite. The current target recorded by aktualizr-lite
+// in sql.db is seeded as the last successful update to the compose update DB, so the first fioup run
+// syncs the running target rather than reinstalling it, and the aktualizr-lite specific `pacman`
+// settings are converted to their fioup counterparts.
+func Migrate(ctx context.Context, cfg *config.Config, opts *MigrateOptions) (*MigrateResult, error) {
+	if err := register.CheckUpdateClientNotRunning(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAkliteIsRunning, err)
+	}
+
+	if lastUpdate, err := update.GetLastSuccessfulUpdate(cfg.ComposeConfig()); err == nil && !opts.Force {
+		return nil, fmt.Errorf("%w: update %s to %s", ErrAlreadyMigrated, lastUpdate.ID, lastUpdate.ClientRef)
+	} else if err != nil && !errors.Is(err, update.ErrUpdateNotFound) {
+		return nil, fmt.Errorf("failed to read the compose update DB: %w", err)
+	}
+
+	var current target.Target
+	var err error
+	if opts.DryRun {
+		// Neither the schema nor the journal mode of sql.db written by aktualizr-lite is changed on a dry run
+		current, err = targets.GetCurrentTargetReadOnly(cfg.GetDBPath())
+	} else {
+		// Upgrade the schema of sql.db written by aktualizr-lite
+		if err := db.InitializeDatabase(cfg.GetDBPath()); err != nil {
+			return nil, err
+		}
+		current, err = targets.GetCurrentTarget(cfg.GetDBPath())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current target: %w", err)
+	}
+	if current.IsUnknown() {
+		return nil, ErrNoCurrentTarget
+	}
+	current.ShortlistApps(cfg.GetEnabledApps())
+	res := &MigrateResult{Target: current}
+
+	if err := checkAppStore(ctx, cfg.ComposeConfig(), &current, res); err != nil {
+		slog.Warn("Failed to check the apps of the current target in the app store", "error", err)
+	}
+
+	res.ConvertedConfig, res.UnsupportedKeys = convertPacmanConfig(cfg)
+	if len(res.ConvertedConfig) > 0 {
+		res.ConfigFile = filepath.Join(opts.ConfigDir, MigratedConfigFilename)
+	}
+	if opts.DryRun {
+		return res, nil
+	}
+
+	if res.ConfigFile != "" {
+		if err := writeConfig(res.ConfigFile, res.ConvertedConfig); err != nil {
+			return nil, err
+		}
+	}
+	if res.Update, err = seedLastSuccessfulUpdate(cfg.ComposeConfig(), &current); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func checkAppStore(ctx context.Context, cfg *compose.Config, t *target.Target, res *MigrateResult) error {
+	if t.NoApps() {
+		res.AppsFetched, res.AppsInstalled, res.AppsRunning = true, true, true
+		return nil
+	}
+	s, err := compose.CheckAppsStatus(ctx, cfg, t.AppURIs(), compose.WithQuickCheckFetch(true))
+	if err != nil {
+		return err
+	}
+	res.AppsFetched, res.AppsInstalled, res.AppsRunning = s.AreFetched(), s.AreInstalled(), s.AreRunning()
+	return nil
+}
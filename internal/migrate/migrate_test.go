@@ -0,0 +1,85 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/foundriesio/composeapp/pkg/compose"
+	"github.com/foundriesio/composeapp/pkg/update"
+	"github.com/foundriesio/fioup/pkg/config"
+	"github.com/foundriesio/fioup/pkg/target"
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfig(t *testing.T, pacman map[string]string) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	tree, err := toml.TreeFromMap(nil)
+	require.Nil(t, err)
+	tree.Set(config.ServerBaseUrlKey, "https://updates.example.com")
+	tree.Set("storage.path", dir)
+	for key, value := range pacman {
+		tree.Set("pacman."+key, value)
+	}
+	b, err := toml.Marshal(tree)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(filepath.Join(dir, config.DefaultConfigFilename), b, 0644))
+	cfg, err := config.NewConfig([]string{dir})
+	require.Nil(t, err)
+	return cfg
+}
+
+func TestMigrate_SeedLastSuccessfulUpdate(t *testing.T) {
+	cfg := &compose.Config{DBFilePath: filepath.Join(t.TempDir(), "updates.db")}
+	current := &target.Target{
+		ID:      "intel-corei7-64-lmp-42",
+		Version: 42,
+		Apps:    []target.App{{Name: "app1", URI: "hub.io/factory/app1@sha256:c8087fe1b69ccc025c6cedb8747d98e132d7bf8be8081cb2403ebd3b6545ed6a"}},
+	}
+
+	seeded, err := seedLastSuccessfulUpdate(cfg, current)
+	require.Nil(t, err)
+
+	lastUpdate, err := update.GetLastSuccessfulUpdate(cfg)
+	require.Nil(t, err)
+	require.Equal(t, seeded.ID, lastUpdate.ID)
+	require.Equal(t, current.ID, lastUpdate.ClientRef)
+	require.Equal(t, current.AppURIs(), lastUpdate.URIs)
+	_, err = update.GetCurrentUpdate(cfg)
+	require.ErrorIs(t, err, update.ErrUpdateNotFound)
+	failed, err := update.CountFailedUpdates(cfg, current.ID)
+	require.Nil(t, err)
+	require.Equal(t, 0, failed)
+}
+
+func TestMigrate_ConvertPacmanConfig(t *testing.T) {
+	cfg := newTestConfig(t, map[string]string{
+		"docker_prune":     "0",
+		"callback_program": "/usr/bin/callback",
+		"ostree_server":    "https://ostree.example.com",
+		"tags":             "main",
+	})
+
+	converted, unsupported := convertPacmanConfig(cfg)
+	require.Equal(t, map[string]string{config.ComposeAppsPruneUnusedImagesKey: "0"}, converted)
+	require.Equal(t, []string{"pacman.callback_program", "pacman.ostree_server"}, unsupported)
+
+	configFile := filepath.Join(t.TempDir(), MigratedConfigFilename)
+	require.Nil(t, writeConfig(configFile, converted))
+	tree, err := toml.LoadFile(configFile)
+	require.Nil(t, err)
+	require.Equal(t, "0", tree.Get(config.ComposeAppsPruneUnusedImagesKey))
+
+	// A fioup setting that is already set is kept
+	cfg = newTestConfig(t, map[string]string{
+		"docker_prune":        "0",
+		"prune_unused_images": "1",
+	})
+	converted, _ = convertPacmanConfig(cfg)
+	require.Empty(t, converted)
+}
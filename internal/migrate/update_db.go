@@ -0,0 +1,65 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/foundriesio/composeapp/pkg/compose"
+	"github.com/foundriesio/composeapp/pkg/update"
+	"github.com/foundriesio/fioup/pkg/target"
+	"github.com/oklog/ulid/v2"
+	"go.etcd.io/bbolt"
+)
+
+// seedLastSuccessfulUpdate adds a completed update of the target to the compose update DB.
+// The update package has no API to record an update that was not run by it, so the record is written
+// the same way the update package stores it: the key combines the update ULID and the target name.
+func seedLastSuccessfulUpdate(cfg *compose.Config, t *target.Target) (*update.Update, error) {
+	entropy := ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0)
+	id, err := ulid.New(ulid.Timestamp(time.Now()), entropy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate update ID: %w", err)
+	}
+	now := time.Now()
+	u := &update.Update{
+		ID:           id.String(),
+		ClientRef:    t.ID,
+		State:        update.StateCompleted,
+		Progress:     100,
+		CreationTime: now,
+		InitTime:     now,
+		FetchTime:    now,
+		UpdateTime:   now,
+		URIs:         t.AppURIs(),
+		Blobs:        compose.BlobsFetchProgress{},
+		LoadedImages: map[string]struct{}{},
+	}
+	data, err := json.Marshal(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal update: %w", err)
+	}
+
+	updateDB, err := bbolt.Open(cfg.DBFilePath, 0600, &bbolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open compose update DB: %w", err)
+	}
+	defer func() {
+		_ = updateDB.Close()
+	}()
+	err = updateDB.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(update.UpdatesBucketName))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(fmt.Sprintf("%s:cref:%s", u.ID, u.ClientRef)), data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save update to compose update DB: %w", err)
+	}
+	return u, nil
+}
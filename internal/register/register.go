@@ -22,11 +22,14 @@ func sotaCleanup(opt *RegisterOptions) error {
 	slog.Debug("Cleaning up SOTA files",
 		"directory", opt.SotaDir)
 
-	if fileExists(sql) {
-		slog.Debug("Removing file",
-			"file", sql)
-		if err := os.Remove(sql); err != nil {
-			return err
+	// The write-ahead log and shared memory files are left next to the database in WAL mode
+	for _, f := range []string{sql, sql + "-wal", sql + "-shm"} {
+		if fileExists(f) {
+			slog.Debug("Removing file",
+				"file", f)
+			if err := os.Remove(f); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -59,7 +62,8 @@ func checkSotaFiles(opt *RegisterOptions) error {
 	return sotaCleanup(opt)
 }
 
-func checkUpdateClientNotRunning() error {
+// CheckUpdateClientNotRunning returns an error if aktualizr-lite holds its lock, i.e. it is running
+func CheckUpdateClientNotRunning() error {
 	// TODO: use lock in new update client?
 	aklock := AKLITE_LOCK
 
@@ -135,7 +139,7 @@ func checkDeviceStatus(opt *RegisterOptions) error {
 	}
 
 	// Update client must not be running
-	if err := checkUpdateClientNotRunning(); err != nil {
+	if err := CheckUpdateClientNotRunning(); err != nil {
 		return err
 	}
 
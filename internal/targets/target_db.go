@@ -5,13 +5,13 @@ package targets
 
 import (
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strconv"
 
+	"github.com/foundriesio/fioup/internal/db"
 	"github.com/foundriesio/fioup/pkg/target"
-	_ "modernc.org/sqlite"
 )
 
 type TargetCustom struct {
@@ -26,6 +26,10 @@ const (
 	updateModeCurrent int = 1
 	updateModePending int = 2
 	updateModeFailed  int = 3
+
+	// emptySha256 is the hash of no data, stored if the hash of the target is unknown,
+	// e.g. if the target is composed out of an update rather than read from the targets metadata
+	emptySha256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
 )
 
 func RegisterInstallationStarted(dbFilePath string, target *target.Target, correlationId string) error {
@@ -40,87 +44,65 @@ func RegisterInstallationFailed(dbFilePath string, target *target.Target, correl
 	return saveInstalledVersions(dbFilePath, target, correlationId, updateModeFailed)
 }
 
-func CreateTargetsTable(dbFilePath string) error {
-	db, err := sql.Open("sqlite", dbFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
-	}
-	defer func() {
-		if closeErr := db.Close(); closeErr != nil {
-			slog.Error("failed to close db", "error", closeErr)
-		}
-	}()
-
-	_, err = db.Exec(`
-CREATE TABLE IF NOT EXISTS installed_versions(
-	id INTEGER PRIMARY KEY,
-	ecu_serial TEXT NOT NULL,
-	sha256 TEXT NOT NULL,
-	name TEXT NOT NULL,
-	hashes TEXT NOT NULL,
-	length INTEGER NOT NULL DEFAULT 0,
-	correlation_id TEXT NOT NULL DEFAULT "",
-	is_current INTEGER NOT NULL CHECK (is_current IN (0,1)) DEFAULT 0,
-	is_pending INTEGER NOT NULL CHECK (is_pending IN (0,1)) DEFAULT 0,
-	was_installed INTEGER NOT NULL CHECK (was_installed IN (0,1)) DEFAULT 0,
-	custom_meta TEXT NOT NULL DEFAULT ""
-);`)
-	if err != nil {
-		return fmt.Errorf("failed to create installed_versions table: %w", err)
-	}
-
-	return nil
-}
-
+// IsFailingTarget reports whether an installation of the target has failed before
 func IsFailingTarget(dbFilePath string, name string) (bool, error) {
-	db, err := sql.Open("sqlite", dbFilePath)
+	sqlDB, err := db.Open(dbFilePath)
 	if err != nil {
 		return false, err
 	}
-	defer func() {
-		if closeErr := db.Close(); closeErr != nil {
-			slog.Error("failed to close database", "error", closeErr)
-		}
-	}()
 
-	rows, err := db.Query("SELECT name FROM installed_versions WHERE name = ? AND was_installed = 0;", name)
+	var count int
+	err = sqlDB.QueryRow("SELECT COUNT(*) FROM installed_versions WHERE name = ? AND was_installed = 0 AND is_pending = 0;", name).Scan(&count)
 	if err != nil {
 		return false, fmt.Errorf("failed to select installed_versions: %w", err)
 	}
 
-	var count int
-	for rows.Next() {
-		count++
-	}
+	return count > 0, nil
+}
 
-	if count > 0 {
-		return true, nil
+// GetCurrentTarget returns the target marked as current in the installed_versions table,
+// or target.UnknownTarget if there is no current target
+func GetCurrentTarget(dbFilePath string) (target.Target, error) {
+	sqlDB, err := db.Open(dbFilePath)
+	if err != nil {
+		return target.UnknownTarget, err
 	}
-
-	return false, nil
+	return getCurrentTarget(sqlDB)
 }
 
-func GetCurrentTarget(dbFilePath string) (target.Target, error) {
-	db, err := sql.Open("sqlite", dbFilePath)
+// GetCurrentTargetReadOnly is GetCurrentTarget that does not change the database, even its schema.
+// It reads the databases written by aktualizr-lite and by the fioup releases preceding the schema versioning too.
+func GetCurrentTargetReadOnly(dbFilePath string) (target.Target, error) {
+	sqlDB, err := db.OpenReadOnly(dbFilePath)
 	if err != nil {
 		return target.UnknownTarget, err
 	}
 	defer func() {
-		if closeErr := db.Close(); closeErr != nil {
+		if closeErr := sqlDB.Close(); closeErr != nil {
 			slog.Error("failed to close database", "error", closeErr)
 		}
 	}()
+	return getCurrentTarget(sqlDB)
+}
 
-	rows, err := db.Query("SELECT name, custom_meta FROM installed_versions WHERE is_current = 1;")
+func getCurrentTarget(sqlDB *sql.DB) (target.Target, error) {
+	rows, err := sqlDB.Query("SELECT name, sha256, length, custom_meta FROM installed_versions WHERE is_current = 1;")
 	if err != nil {
 		return target.UnknownTarget, err
 	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			slog.Error("failed to close rows", "error", closeErr)
+		}
+	}()
 
 	var name string
+	var sha256 string
+	var length int64
 	var customMeta string
 
 	for rows.Next() {
-		if err = rows.Scan(&name, &customMeta); err != nil {
+		if err = rows.Scan(&name, &sha256, &length, &customMeta); err != nil {
 			return target.UnknownTarget, err
 		}
 	}
@@ -131,109 +113,150 @@ func GetCurrentTarget(dbFilePath string) (target.Target, error) {
 
 	slog.Debug("Current target", "target_id", name)
 
+	if name == "" {
+		return target.UnknownTarget, nil
+	}
+	// The fioup releases preceding the aktualizr-lite format stored the fioup target
 	var t target.Target
-	if name != "" {
-		if err = json.Unmarshal([]byte(customMeta), &t); err != nil {
-			return target.UnknownTarget, fmt.Errorf("failed to unmarshal custom metadata: %v '%s'", err, customMeta)
-		}
+	if err = json.Unmarshal([]byte(customMeta), &t); err == nil && t.ID != "" {
+		return t, nil
+	}
+	t, err = parseCustomMeta(name, customMeta)
+	if err != nil {
+		return target.UnknownTarget, err
+	}
+	if sha256 != emptySha256 {
+		t.Sha256, t.Length = sha256, length
 	}
 	return t, nil
 }
 
-func saveInstalledVersions(dbFilePath string, target *target.Target, correlationId string, updateMode int) error {
-	slog.Debug("Saving installed version", "correlation_id", correlationId, "target_id", target.ID, "mode", updateMode)
-	db, err := sql.Open("sqlite", dbFilePath)
-	if err != nil {
-		return err
+// parseCustomMeta composes the target out of the custom metadata stored by aktualizr-lite
+func parseCustomMeta(name string, customMeta string) (target.Target, error) {
+	var custom target.Custom
+	if err := json.Unmarshal([]byte(customMeta), &custom); err != nil {
+		return target.UnknownTarget, fmt.Errorf("failed to unmarshal custom metadata: %v '%s'", err, customMeta)
 	}
-	defer func() {
-		if closeErr := db.Close(); closeErr != nil {
-			slog.Error("failed to close database", "error", closeErr)
+	t := target.Target{ID: name, Version: -1, Custom: custom.Raw}
+	if version, err := strconv.Atoi(custom.Version); err == nil {
+		t.Version = version
+	}
+	for appName, app := range custom.Apps {
+		t.Apps = append(t.Apps, target.App{Name: appName, URI: app.URI})
+	}
+	return t, nil
+}
+
+// marshalCustomMeta returns the custom metadata of the target in the aktualizr-lite format. Its apps are
+// the installed ones, i.e. the target apps shortlisted by the configuration, rather than all the target apps.
+func marshalCustomMeta(t *target.Target) ([]byte, error) {
+	var custom map[string]any
+	if len(t.Custom) > 0 {
+		if err := json.Unmarshal(t.Custom, &custom); err != nil {
+			return nil, err
 		}
-	}()
+	}
+	if custom == nil {
+		custom = map[string]any{}
+	}
+	if _, ok := custom["version"]; !ok {
+		custom["version"] = strconv.Itoa(t.Version)
+	}
+	apps := map[string]any{}
+	for _, app := range t.Apps {
+		apps[app.Name] = map[string]string{"uri": app.URI}
+	}
+	custom["docker_compose_apps"] = apps
+	return json.Marshal(custom)
+}
 
-	var oldWasInstalled *bool = nil
-	// var oldName string = ""
-	rows, err := db.Query("SELECT name, was_installed FROM installed_versions ORDER BY id DESC LIMIT 1;")
+func saveInstalledVersions(dbFilePath string, target *target.Target, correlationId string, updateMode int) error {
+	slog.Debug("Saving installed version", "correlation_id", correlationId, "target_id", target.ID, "mode", updateMode)
+	sqlDB, err := db.Open(dbFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to select installed_versions: %w", err)
+		return err
 	}
 
-	for rows.Next() {
+	// The installed versions are read and updated by several statements, run them in a transaction
+	// so a concurrent writer or a crash cannot leave the table with no current or several pending versions
+	return db.WithTransaction(sqlDB, func(tx *sql.Tx) error {
+		var oldWasInstalled *bool = nil
 		var name string
 		var wasInstalled bool
-		if err = rows.Scan(&name, &wasInstalled); err != nil {
-			return fmt.Errorf("get name: %w", err)
+		err := tx.QueryRow("SELECT name, was_installed FROM installed_versions ORDER BY id DESC LIMIT 1;").Scan(&name, &wasInstalled)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to select installed_versions: %w", err)
 		}
-
-		if name == target.ID {
+		if err == nil && name == target.ID {
 			slog.Debug("DB: Target was installed before")
 			oldWasInstalled = BoolPointer(wasInstalled)
-			// oldName = name
 		}
-	}
 
-	switch updateMode {
-	case updateModeCurrent:
-		// unset 'current' and 'pending' on all versions for this ecu
-		_, err = db.Exec("UPDATE installed_versions SET is_current = 0, is_pending = 0")
-		if err != nil {
-			return fmt.Errorf("failed to update installed 1 versions: %w", err)
-		}
+		switch updateMode {
+		case updateModeCurrent:
+			// unset 'current' and 'pending' on all versions for this ecu
+			_, err = tx.Exec("UPDATE installed_versions SET is_current = 0, is_pending = 0")
+			if err != nil {
+				return fmt.Errorf("failed to update installed 1 versions: %w", err)
+			}
 
-	case updateModePending:
-		// unset 'pending' on all versions for this ecu
-		_, err = db.Exec("UPDATE installed_versions SET is_pending = 0")
-		if err != nil {
-			return fmt.Errorf("failed to update installed 2 versions: %w", err)
+		case updateModePending:
+			// unset 'pending' on all versions for this ecu
+			_, err = tx.Exec("UPDATE installed_versions SET is_pending = 0")
+			if err != nil {
+				return fmt.Errorf("failed to update installed 2 versions: %w", err)
+			}
 		}
-	}
 
-	if oldWasInstalled != nil {
-		if updateMode == updateModeFailed {
-			_, err = db.Exec(
-				"UPDATE installed_versions SET is_pending = 0, was_installed = 0 WHERE name = ?;",
-				target.ID,
-			)
-			if err != nil {
-				return fmt.Errorf("failed to save installed versions: %w", err)
+		if oldWasInstalled != nil {
+			if updateMode == updateModeFailed {
+				_, err = tx.Exec(
+					"UPDATE installed_versions SET is_pending = 0, was_installed = 0 WHERE name = ?;",
+					target.ID,
+				)
+				if err != nil {
+					return fmt.Errorf("failed to save installed versions: %w", err)
+				}
+			} else {
+				_, err = tx.Exec(
+					"UPDATE installed_versions SET correlation_id = ?, is_current = ?, is_pending = ?, was_installed = ? WHERE name = ?;",
+					correlationId,
+					updateMode == updateModeCurrent,                     // is_current
+					updateMode == updateModePending,                     // is_pending
+					updateMode == updateModeCurrent || *oldWasInstalled, // was_installed
+					target.ID,
+				)
+				if err != nil {
+					return fmt.Errorf("failed to save installed versions: %w", err)
+				}
 			}
 		} else {
-			_, err = db.Exec(
-				"UPDATE installed_versions SET correlation_id = ?, is_current = ?, is_pending = ?, was_installed = ? WHERE name = ?;",
-				correlationId,
-				updateMode == updateModeCurrent,                     // is_current
-				updateMode == updateModePending,                     // is_pending
-				updateMode == updateModeCurrent || *oldWasInstalled, // was_installed
+			// The row is written the way aktualizr-lite does, so the tools reading its database can read it too
+			customMeta, err := marshalCustomMeta(target)
+			if err != nil {
+				return fmt.Errorf("failed to marshal custom metadata: %w", err)
+			}
+			sha256 := target.Sha256
+			if sha256 == "" {
+				sha256 = emptySha256
+			}
+			_, err = tx.Exec(
+				"INSERT INTO installed_versions (ecu_serial, sha256, name, hashes, length, custom_meta, correlation_id, is_current, is_pending, was_installed) VALUES (?,?,?,?,?,?,?,?,?,?);",
+				"",
+				sha256,
 				target.ID,
+				"sha256:"+sha256,
+				target.Length,
+				string(customMeta),
+				correlationId,
+				updateMode == updateModeCurrent, // is_current
+				updateMode == updateModePending, // is_pending
+				updateMode == updateModeCurrent, // was_installed
 			)
 			if err != nil {
 				return fmt.Errorf("failed to save installed versions: %w", err)
 			}
 		}
-	} else {
-		customMeta, err := json.Marshal(target)
-		if err != nil {
-			return fmt.Errorf("failed to marshal custom metadata: %w", err)
-		}
-		sha256 := hex.EncodeToString([]byte("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
-		_, err = db.Exec(
-			"INSERT INTO installed_versions (ecu_serial, sha256, name, hashes, length, custom_meta, correlation_id, is_current, is_pending, was_installed) VALUES (?,?,?,?,?,?,?,?,?,?);",
-			"",
-			sha256,
-			target.ID,
-			"sha256:"+sha256,
-			0,
-			string(customMeta),
-			correlationId,
-			updateMode == updateModeCurrent, // is_current
-			updateMode == updateModePending, // is_pending
-			updateMode == updateModeCurrent, // was_installed
-		)
-		if err != nil {
-			return fmt.Errorf("failed to save installed versions: %w", err)
-		}
-	}
-
-	return nil
+		return nil
+	})
 }
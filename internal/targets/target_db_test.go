@@ -0,0 +1,154 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package targets
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/foundriesio/fioup/internal/db"
+	"github.com/foundriesio/fioup/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDB(t *testing.T) string {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "sql.db")
+	require.Nil(t, db.InitializeDatabase(dbPath))
+	t.Cleanup(func() {
+		require.Nil(t, db.Close(dbPath))
+	})
+	return dbPath
+}
+
+func TestInstalledVersions_Lifecycle(t *testing.T) {
+	dbPath := newTestDB(t)
+	t1 := &target.Target{ID: "intel-corei7-64-lmp-1", Version: 1, Apps: []target.App{{Name: "app1", URI: "hub.io/f/app1@sha256:1"}}}
+	t2 := &target.Target{ID: "intel-corei7-64-lmp-2", Version: 2}
+
+	current, err := GetCurrentTarget(dbPath)
+	require.Nil(t, err)
+	require.True(t, current.IsUnknown())
+
+	require.Nil(t, RegisterInstallationStarted(dbPath, t1, "corr-1"))
+	failing, err := IsFailingTarget(dbPath, t1.ID)
+	require.Nil(t, err)
+	require.False(t, failing)
+	require.Nil(t, RegisterInstallationSuceeded(dbPath, t1, "corr-1"))
+	current, err = GetCurrentTarget(dbPath)
+	require.Nil(t, err)
+	require.True(t, current.Equals(t1))
+
+	// A failed installation keeps the previous target current
+	require.Nil(t, RegisterInstallationStarted(dbPath, t2, "corr-2"))
+	require.Nil(t, RegisterInstallationFailed(dbPath, t2, "corr-2"))
+	failing, err = IsFailingTarget(dbPath, t2.ID)
+	require.Nil(t, err)
+	require.True(t, failing)
+	current, err = GetCurrentTarget(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, t1.ID, current.ID)
+}
+
+func TestInstalledVersions_AkliteFormat(t *testing.T) {
+	dbPath := newTestDB(t)
+	// The target apps are shortlisted to app1
+	t1 := &target.Target{
+		ID:      "intel-corei7-64-lmp-7",
+		Version: 7,
+		Apps:    []target.App{{Name: "app1", URI: "hub.io/f/app1@sha256:1"}},
+		Sha256:  "5d41402abc4b2a76b9719d911017c592ae41e4649b934ca495991b7852b85500",
+		Length:  1234,
+		Custom: []byte(`{"version":"7","docker_compose_apps":{"app1":{"uri":"hub.io/f/app1@sha256:1"},` +
+			`"app2":{"uri":"hub.io/f/app2@sha256:2"}},"hardwareIds":["intel-corei7-64"],"tags":["main"]}`),
+	}
+	// The target composed out of an update has neither hash nor custom metadata
+	t2 := &target.Target{ID: "intel-corei7-64-lmp-8", Version: 8, Apps: []target.App{{Name: "app1", URI: "hub.io/f/app1@sha256:3"}}}
+	require.Nil(t, RegisterInstallationSuceeded(dbPath, t1, "corr-1"))
+	require.Nil(t, RegisterInstallationStarted(dbPath, t2, "corr-2"))
+
+	sqlDB, err := db.Open(dbPath)
+	require.Nil(t, err)
+	readRow := func(name string) (sha256, hashes string, length int64, customMeta string) {
+		require.Nil(t, sqlDB.QueryRow("SELECT sha256, hashes, length, custom_meta FROM installed_versions WHERE name = ?;", name).
+			Scan(&sha256, &hashes, &length, &customMeta))
+		return
+	}
+
+	sha256, hashes, length, customMeta := readRow(t1.ID)
+	require.Equal(t, t1.Sha256, sha256)
+	require.Equal(t, "sha256:"+t1.Sha256, hashes)
+	require.Equal(t, int64(1234), length)
+	var custom target.Custom
+	require.Nil(t, json.Unmarshal([]byte(customMeta), &custom))
+	require.Equal(t, "7", custom.Version)
+	require.Equal(t, []string{"intel-corei7-64"}, custom.HardwareID)
+	parsed, err := parseCustomMeta(t1.ID, customMeta)
+	require.Nil(t, err)
+	require.True(t, parsed.Equals(t1))
+	require.Equal(t, []string{"main"}, parsed.Tags())
+
+	sha256, hashes, length, customMeta = readRow(t2.ID)
+	require.Equal(t, emptySha256, sha256)
+	require.Equal(t, "sha256:"+emptySha256, hashes)
+	require.Equal(t, int64(0), length)
+	parsed, err = parseCustomMeta(t2.ID, customMeta)
+	require.Nil(t, err)
+	require.True(t, parsed.Equals(t2))
+
+	current, err := GetCurrentTarget(dbPath)
+	require.Nil(t, err)
+	require.True(t, current.Equals(t1))
+	require.Equal(t, t1.Sha256, current.Sha256)
+	require.Equal(t, t1.Length, current.Length)
+}
+
+func TestInstalledVersions_AkliteCurrentTarget(t *testing.T) {
+	dbPath := newTestDB(t)
+	sqlDB, err := db.Open(dbPath)
+	require.Nil(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO installed_versions (ecu_serial, sha256, name, hashes, custom_meta, is_current, was_installed)
+		VALUES ('', 'abc', 'intel-corei7-64-lmp-42', 'sha256:abc',
+		'{"version":"42","docker_compose_apps":{"app1":{"uri":"hub.io/f/app1@sha256:1"}},"hardwareIds":["intel-corei7-64"]}', 1, 1);`)
+	require.Nil(t, err)
+
+	current, err := GetCurrentTarget(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, "intel-corei7-64-lmp-42", current.ID)
+	require.Equal(t, 42, current.Version)
+	require.Equal(t, []target.App{{Name: "app1", URI: "hub.io/f/app1@sha256:1"}}, current.Apps)
+}
+
+func TestInstalledVersions_AkliteCurrentTargetReadOnly(t *testing.T) {
+	// The database written by aktualizr-lite, in the rollback journal mode and without the schema versioning
+	dbPath := filepath.Join(t.TempDir(), "sql.db")
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	require.Nil(t, err)
+	_, err = sqlDB.Exec(`CREATE TABLE installed_versions(id INTEGER PRIMARY KEY, ecu_serial TEXT NOT NULL, sha256 TEXT NOT NULL,
+		name TEXT NOT NULL, hashes TEXT NOT NULL, length INTEGER NOT NULL DEFAULT 0, correlation_id TEXT NOT NULL DEFAULT "",
+		is_current INTEGER NOT NULL DEFAULT 0, is_pending INTEGER NOT NULL DEFAULT 0, was_installed INTEGER NOT NULL DEFAULT 0,
+		custom_meta TEXT NOT NULL DEFAULT "");
+	INSERT INTO installed_versions (ecu_serial, sha256, name, hashes, custom_meta, is_current, was_installed)
+		VALUES ('', 'abc', 'intel-corei7-64-lmp-42', 'sha256:abc', '{"version":"42"}', 1, 1);`)
+	require.Nil(t, err)
+	require.Nil(t, sqlDB.Close())
+	before, err := os.ReadFile(dbPath)
+	require.Nil(t, err)
+
+	current, err := GetCurrentTargetReadOnly(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, "intel-corei7-64-lmp-42", current.ID)
+	require.Equal(t, 42, current.Version)
+
+	after, err := os.ReadFile(dbPath)
+	require.Nil(t, err)
+	require.Equal(t, before, after)
+	require.NoFileExists(t, dbPath+"-wal")
+
+	_, err = GetCurrentTargetReadOnly(filepath.Join(t.TempDir(), "sql.db"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
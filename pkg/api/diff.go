@@ -45,18 +45,14 @@ func Diff(ctx context.Context, cfg *config.Config, fromVersion, toVersion int, o
 		return nil, fmt.Errorf("failed to create gateway client: %w", err)
 	}
 
-	var targetRepo target.Repo
-	if opts.EnableTUF {
-		targetRepo, err = target.NewTufRepo(cfg, gwClient, cfg.GetHardwareID())
-	} else {
-		targetRepo, err = target.NewPlainRepo(gwClient, cfg.GetTargetsFilepath(), cfg.GetHardwareID())
-	}
+	// The diff is made without the update lock, so the stored metadata must not be written
+	targetRepo, err := target.NewRepo(cfg, gwClient, opts.EnableTUF, target.WithReadOnly(true))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create target repo: %w", err)
 	}
 
 	var targets target.Targets
-	if targets, _, err = targetRepo.LoadTargets(false); err != nil {
+	if targets, _, err = targetRepo.LoadTargets(ctx, false); err != nil {
 		return nil, fmt.Errorf("failed to load targets: %w", err)
 	}
 
@@ -0,0 +1,169 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/foundriesio/composeapp/pkg/update"
+	"github.com/foundriesio/fioup/pkg/config"
+	"github.com/foundriesio/fioup/pkg/target"
+)
+
+type (
+	TargetsOptions struct {
+		// All includes the targets that are not available to the device
+		All bool
+		// MinVersion and MaxVersion limit the versions of the targets; -1 means no limit
+		MinVersion int
+		MaxVersion int
+		// Limit is the max number of the latest targets to return; 0 means no limit
+		Limit int
+		// EnableTUF reads the targets metadata stored by the TUF client instead of targets.json
+		EnableTUF bool
+	}
+	TargetsOption func(*TargetsOptions)
+
+	TargetInfo struct {
+		target.Target
+		Current    bool `json:"current"`
+		Latest     bool `json:"latest"`
+		InProgress bool `json:"in_progress"`
+		Available  bool `json:"available"`
+		// Reason is why the target is not available to the device
+		Reason string `json:"reason,omitempty"`
+		// FailedAttempts is the number of failed updates to the target; set by GetTarget only
+		FailedAttempts int `json:"failed_attempts"`
+	}
+)
+
+var (
+	ErrTargetNotFound = errors.New("target not found")
+)
+
+func WithAllTargets(all bool) TargetsOption {
+	return func(opts *TargetsOptions) {
+		opts.All = all
+	}
+}
+
+func WithVersionRange(minVersion, maxVersion int) TargetsOption {
+	return func(opts *TargetsOptions) {
+		opts.MinVersion = minVersion
+		opts.MaxVersion = maxVersion
+	}
+}
+
+func WithLimit(limit int) TargetsOption {
+	return func(opts *TargetsOptions) {
+		opts.Limit = limit
+	}
+}
+
+func WithTargetsTUF(enabled bool) TargetsOption {
+	return func(opts *TargetsOptions) {
+		opts.EnableTUF = enabled
+	}
+}
+
+// ListTargets returns the targets found in the stored targets metadata sorted by version.
+// It does not make any requests to the Device Gateway.
+func ListTargets(cfg *config.Config, options ...TargetsOption) ([]TargetInfo, error) {
+	opts := TargetsOptions{MinVersion: -1, MaxVersion: -1}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	infos, err := loadTargetInfos(cfg, opts.All, opts.EnableTUF)
+	if err != nil {
+		return nil, err
+	}
+	infos = slices.DeleteFunc(infos, func(t TargetInfo) bool {
+		return (opts.MinVersion >= 0 && t.Version < opts.MinVersion) || (opts.MaxVersion >= 0 && t.Version > opts.MaxVersion)
+	})
+	if opts.Limit > 0 && len(infos) > opts.Limit {
+		infos = infos[len(infos)-opts.Limit:]
+	}
+	return infos, nil
+}
+
+// GetTarget returns the target of the given version found in the stored targets metadata.
+// The target available to the device is preferred over the targets of the same version that are not.
+func GetTarget(cfg *config.Config, version int, options ...TargetsOption) (*TargetInfo, error) {
+	opts := TargetsOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	infos, err := loadTargetInfos(cfg, true, opts.EnableTUF)
+	if err != nil {
+		return nil, err
+	}
+	var found *TargetInfo
+	for i := range infos {
+		if infos[i].Version == version && (found == nil || (!found.Available && infos[i].Available)) {
+			found = &infos[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: version %d", ErrTargetNotFound, version)
+	}
+	if found.FailedAttempts, err = update.CountFailedUpdates(cfg.ComposeConfig(), found.ID); err != nil {
+		slog.Debug("failed to count failed updates", "target", found.ID, "error", err)
+	}
+	return found, nil
+}
+
+func loadTargetInfos(cfg *config.Config, all bool, enableTUF bool) ([]TargetInfo, error) {
+	// Only the stored metadata is read, so no Device Gateway client is needed
+	repo, err := target.NewStoredRepo(cfg, enableTUF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create target repo: %w", err)
+	}
+	// The stored metadata is loaded without any request to Device Gateway
+	targets, _, err := repo.LoadTargets(context.Background(), false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load targets: %w", err)
+	}
+
+	var currentID, inProgressID string
+	if u, err := update.GetLastSuccessfulUpdate(cfg.ComposeConfig()); err == nil {
+		currentID = u.ClientRef
+	}
+	if r, err := update.GetCurrentUpdate(cfg.ComposeConfig()); err == nil {
+		inProgressID = r.Status().ClientRef
+	}
+	latestID := targets.GetLatestTarget().ID
+
+	infos := make([]TargetInfo, 0, len(targets))
+	for _, t := range targets {
+		infos = append(infos, TargetInfo{
+			Target:     t,
+			Current:    t.ID == currentID,
+			Latest:     t.ID == latestID,
+			InProgress: t.ID == inProgressID,
+			Available:  true,
+		})
+	}
+	if all {
+		for _, d := range repo.DiscardedTargets() {
+			infos = append(infos, TargetInfo{
+				Target:     d.Target,
+				Current:    d.ID == currentID,
+				InProgress: d.ID == inProgressID,
+				Reason:     d.Reason,
+			})
+		}
+	}
+	slices.SortFunc(infos, func(a, b TargetInfo) int {
+		if a.Version != b.Version {
+			return a.Version - b.Version
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return infos, nil
+}
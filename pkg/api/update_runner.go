@@ -85,9 +85,10 @@ func (sm *UpdateRunner) Run(ctx context.Context, cfg *config.Config) error {
 		defer eventSender.Stop()
 	}
 
-	// TODO: add an option to turn on/off sysinfo upload
-	if err := gwClient.PutSysInfo(); err != nil {
-		slog.Error("Unable to upload sysinfo", "error", err)
+	if cfg.GetSysInfoEnabled() {
+		if err := gwClient.PutSysInfo(ctx); err != nil {
+			slog.Error("Unable to upload sysinfo", "error", err)
+		}
 	}
 	if err := gwClient.ReportAppStates(ctx, cfg.ComposeConfig()); err != nil {
 		slog.Debug("failed to report apps states", "error", err)
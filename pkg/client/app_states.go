@@ -4,14 +4,22 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/foundriesio/composeapp/pkg/compose"
 	"github.com/pkg/errors"
 )
@@ -25,6 +33,8 @@ type (
 		Health   string `json:"health,omitempty"`
 		ImageUri string `json:"image"`
 		Logs     string `json:"logs,omitempty"`
+
+		ctrID string
 	}
 
 	AppState struct {
@@ -50,18 +60,35 @@ func (c *GatewayClient) initAppStateReporter() {
 	}
 }
 
+// ReportAppStates reports the states of apps to the Device Gateway if they have changed since the last report.
+// It is safe to call it concurrently, e.g. by an update and the app states monitor.
 func (c *GatewayClient) ReportAppStates(ctx context.Context, cfg *compose.Config) error {
+	// The states are numbered in the order they are read, so the states reported by a concurrent call
+	// after these ones are not overwritten by them
+	seq := c.appStatesSeq.Add(1)
 	currentAppStates, err := getAppStates(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to get app states: %w", err)
 	}
-	if areAppStatesEqual(currentAppStates, c.lastAppStates) {
+	return c.reportAppStates(ctx, cfg, seq, currentAppStates)
+}
+
+// reportAppStates posts the app states if they differ from the last reported ones. The lock is not held while
+// posting, it may take long with the retries, and a concurrent report, e.g. of an update, must not wait for it.
+func (c *GatewayClient) reportAppStates(ctx context.Context, cfg *compose.Config, seq uint64, currentAppStates map[string]AppState) error {
+	c.appStatesLock.Lock()
+	changed := !areAppStatesEqual(currentAppStates, c.lastAppStates)
+	c.appStatesLock.Unlock()
+	if !changed {
 		// No change in app states
 		slog.Debug("no change in app states; skipping reporting to device gateway")
 		return nil
 	}
+	if c.appLogsLines > 0 {
+		addServiceLogs(ctx, cfg, currentAppStates, c.appLogsLines, c.appLogsMaxSize)
+	}
 	statusToReport := AppStates{
-		Ostree:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", // hash of empty string
+		Ostree:     c.OSIdentity().Hash,
 		DeviceTime: time.Now().UTC().Format(time.RFC3339),
 		Apps:       currentAppStates,
 	}
@@ -69,21 +96,30 @@ func (c *GatewayClient) ReportAppStates(ctx context.Context, cfg *compose.Config
 	if err != nil {
 		return fmt.Errorf("failed to marshal status of apps: %w", err)
 	}
-	res, err := c.Post("/apps-states", b)
+	res, err := c.Post(ctx, "/apps-states", b)
 	if err != nil {
 		return fmt.Errorf("failed to post status of apps: %w", err)
 	}
 	if res.StatusCode < 200 || res.StatusCode > 204 {
 		return fmt.Errorf("failed to post status of apps: HTTP_%d - %s", res.StatusCode, res)
 	}
-	if b, err := json.Marshal(currentAppStates); err == nil {
+	c.appStatesLock.Lock()
+	defer c.appStatesLock.Unlock()
+	if seq < c.lastAppStatesSeq {
+		slog.Debug("newer app states have been reported meanwhile; not saving the reported ones")
+		return nil
+	}
+	// The logs are needed only in the report, they are not compared and must not be left on the storage
+	lastAppStates := withoutServiceLogs(currentAppStates)
+	if b, err := json.Marshal(lastAppStates); err == nil {
 		if err := os.WriteFile(c.lastAppStatesFile, b, 0o744); err != nil {
 			slog.Debug("failed to write last app states to file", "error", err)
 		}
 	} else {
 		slog.Debug("failed to marshal last app states", "error", err)
 	}
-	c.lastAppStates = currentAppStates
+	c.lastAppStates = lastAppStates
+	c.lastAppStatesSeq = seq
 	return nil
 }
 
@@ -114,7 +150,7 @@ func getAppStates(ctx context.Context, cfg *compose.Config) (appStates map[strin
 				Status:   srv.Status,
 				Health:   srv.Health,
 				ImageUri: srv.Image,
-				Logs:     "", // TODO: implement logs retrieval
+				ctrID:    srv.CtrID,
 			})
 			if srv.State == "not created" || srv.Health == "unhealthy" {
 				appState = "unhealthy"
@@ -129,20 +165,127 @@ func getAppStates(ctx context.Context, cfg *compose.Config) (appStates map[strin
 	return
 }
 
+// addServiceLogs sets the last lines of container logs to the services that are unhealthy or not running,
+// so the reason of a crash can be seen in the backend
+func addServiceLogs(ctx context.Context, cfg *compose.Config, appStates map[string]AppState, lines int, maxSize int) {
+	var cli *client.Client
+	for appName, appState := range appStates {
+		for i := range appState.Services {
+			srv := &appState.Services[i]
+			if srv.ctrID == "" || !needsLogs(srv) {
+				continue
+			}
+			if cli == nil {
+				var err error
+				if cli, err = compose.GetDockerClient(cfg.DockerHost); err != nil {
+					slog.Debug("failed to create docker client to get service logs", "error", err)
+					return
+				}
+				defer cli.Close()
+			}
+			logs, err := getServiceLogs(ctx, cli, srv.ctrID, lines)
+			if err != nil {
+				slog.Debug("failed to get service logs", "app", appName, "service", srv.Name, "error", err)
+				continue
+			}
+			srv.Logs = truncateLogs(logs, maxSize)
+		}
+	}
+}
+
+// withoutServiceLogs returns a copy of the app states with the logs of services removed
+func withoutServiceLogs(appStates map[string]AppState) map[string]AppState {
+	res := make(map[string]AppState, len(appStates))
+	for appName, appState := range appStates {
+		appState.Services = slices.Clone(appState.Services)
+		for i := range appState.Services {
+			appState.Services[i].Logs = ""
+		}
+		res[appName] = appState
+	}
+	return res
+}
+
+func needsLogs(srv *AppServiceState) bool {
+	switch srv.State {
+	case "exited", "dead", "restarting":
+		return true
+	}
+	return srv.Health == "unhealthy"
+}
+
+func getServiceLogs(ctx context.Context, cli *client.Client, ctrID string, lines int) (string, error) {
+	info, err := cli.ContainerInspect(ctx, ctrID)
+	if err != nil {
+		return "", err
+	}
+	rc, err := cli.ContainerLogs(ctx, ctrID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       strconv.Itoa(lines),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	var buf bytes.Buffer
+	if info.Config != nil && info.Config.Tty {
+		_, err = io.Copy(&buf, rc)
+	} else {
+		// stdout and stderr are multiplexed into one stream if a container has no TTY
+		_, err = stdcopy.StdCopy(&buf, &buf, rc)
+	}
+	return buf.String(), err
+}
+
+// truncateLogs keeps the tail of the logs that fits into maxSize bytes, starting from a beginning of a line
+// if possible, as the last lines are the most relevant ones
+func truncateLogs(logs string, maxSize int) string {
+	const marker = "...\n"
+	if maxSize <= 0 || len(logs) <= maxSize {
+		return logs
+	}
+	if maxSize <= len(marker) {
+		return logs[len(logs)-maxSize:]
+	}
+	start := len(logs) - (maxSize - len(marker))
+	tail := logs[start:]
+	if logs[start-1] == '\n' {
+		return marker + tail
+	}
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	return marker + tail
+}
+
+// areAppStatesEqual compares the app states including the state and health of each service.
+// The human-readable status (e.g. "Up 5 minutes") and logs of services change constantly, so they are ignored.
 func areAppStatesEqual(a, b map[string]AppState) bool {
-	// Compare two slices of AppState for equality, ignoring the order of services
 	if len(a) != len(b) {
 		return false
 	}
-	for uri, appA := range a {
-		appB, ok := b[uri]
+	for name, appA := range a {
+		appB, ok := b[name]
 		if !ok {
-			// App with this URI not found in b
 			return false
 		}
-		if appA.State != appB.State || len(appA.Services) != len(appB.Services) {
+		if appA.Uri != appB.Uri || appA.State != appB.State || len(appA.Services) != len(appB.Services) {
+			return false
+		}
+		// The order of services is not guaranteed, so compare sorted lists of their states
+		if !slices.Equal(serviceStateKeys(appA.Services), serviceStateKeys(appB.Services)) {
 			return false
 		}
 	}
 	return true
 }
+
+func serviceStateKeys(services []AppServiceState) []string {
+	keys := make([]string, 0, len(services))
+	for _, srv := range services {
+		keys = append(keys, strings.Join([]string{srv.Name, srv.Hash, srv.State, srv.Health, srv.ImageUri}, "|"))
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,204 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	dockerevents "github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/foundriesio/composeapp/pkg/compose"
+	"github.com/foundriesio/fioup/pkg/config"
+)
+
+const (
+	// Time to wait for more container events before reporting, e.g. when all services of an app are being restarted
+	appStatesDebounce = 2 * time.Second
+	// Time to wait before reconnecting to the docker events stream after it failed
+	dockerEventsRetryInterval = 30 * time.Second
+)
+
+type (
+	// AppStatesMonitor reports the app states to the Device Gateway as soon as they change.
+	// The changes are detected by watching the docker container events and by polling the app states periodically,
+	// the latter catches the changes that may be missed if the docker events stream is not available.
+	AppStatesMonitor struct {
+		gw           *GatewayClient
+		cfg          *compose.Config
+		pollInterval time.Duration
+		watchEvents  bool
+
+		suspended   atomic.Bool
+		triggerChan chan struct{}
+		cancel      context.CancelFunc
+		wg          sync.WaitGroup
+	}
+)
+
+// Container event actions that may change the state of an app service
+var appStateActions = map[dockerevents.Action]bool{
+	dockerevents.ActionCreate:  true,
+	dockerevents.ActionStart:   true,
+	dockerevents.ActionRestart: true,
+	dockerevents.ActionStop:    true,
+	dockerevents.ActionPause:   true,
+	dockerevents.ActionUnPause: true,
+	dockerevents.ActionKill:    true,
+	dockerevents.ActionDie:     true,
+	dockerevents.ActionOOM:     true,
+	dockerevents.ActionDestroy: true,
+}
+
+func NewAppStatesMonitor(cfg *config.Config, gw *GatewayClient) *AppStatesMonitor {
+	return &AppStatesMonitor{
+		gw:           gw,
+		cfg:          cfg.ComposeConfig(),
+		pollInterval: cfg.GetAppStatesPollInterval(),
+		watchEvents:  cfg.GetAppStatesWatchEvents(),
+	}
+}
+
+func (m *AppStatesMonitor) Start() {
+	if m.cancel != nil {
+		return
+	}
+	if m.pollInterval == 0 && !m.watchEvents {
+		slog.Debug("App states monitor is disabled")
+		return
+	}
+	slog.Debug("Starting app states monitor", "poll_interval", m.pollInterval, "watch_events", m.watchEvents)
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.triggerChan = make(chan struct{}, 1)
+	if m.watchEvents {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.watchDockerEvents(ctx)
+		}()
+	}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.run(ctx)
+	}()
+}
+
+func (m *AppStatesMonitor) Stop() {
+	if m.cancel == nil {
+		return
+	}
+	slog.Debug("Stopping app states monitor")
+	m.cancel()
+	m.wg.Wait()
+	m.cancel = nil
+	slog.Debug("App states monitor stopped")
+}
+
+// Suspend stops reporting the app states until Resume is called, e.g. while an update is stopping and starting apps,
+// so the transitional states are not reported.
+func (m *AppStatesMonitor) Suspend() {
+	m.suspended.Store(true)
+}
+
+// Resume resumes reporting the app states and checks them for changes made while the monitor was suspended
+func (m *AppStatesMonitor) Resume() {
+	m.suspended.Store(false)
+	m.trigger()
+}
+
+func (m *AppStatesMonitor) trigger() {
+	if m.triggerChan == nil {
+		return
+	}
+	select {
+	case m.triggerChan <- struct{}{}:
+	default:
+		// a check is already pending
+	}
+}
+
+func (m *AppStatesMonitor) run(ctx context.Context) {
+	var pollChan <-chan time.Time
+	if m.pollInterval > 0 {
+		ticker := time.NewTicker(m.pollInterval)
+		defer ticker.Stop()
+		pollChan = ticker.C
+	}
+	debounce := time.NewTimer(appStatesDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.triggerChan:
+			debounce.Reset(appStatesDebounce)
+		case <-debounce.C:
+			m.report(ctx)
+		case <-pollChan:
+			m.report(ctx)
+		}
+	}
+}
+
+func (m *AppStatesMonitor) report(ctx context.Context) {
+	if m.suspended.Load() {
+		slog.Debug("App states monitor is suspended; skipping app states check")
+		return
+	}
+	if err := m.gw.ReportAppStates(ctx, m.cfg); err != nil && ctx.Err() == nil {
+		slog.Debug("failed to report apps states", "error", err)
+	}
+}
+
+func (m *AppStatesMonitor) watchDockerEvents(ctx context.Context) {
+	cli, err := compose.GetDockerClient(m.cfg.DockerHost)
+	if err != nil {
+		slog.Warn("Failed to create docker client; app states are checked only periodically", "error", err)
+		return
+	}
+	defer cli.Close()
+	for {
+		msgs, errs := cli.Events(ctx, types.EventsOptions{
+			Filters: filters.NewArgs(
+				filters.Arg("type", string(dockerevents.ContainerEventType)),
+				filters.Arg("label", compose.AppServiceHashLabelKey),
+			),
+		})
+	events:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-msgs:
+				if isAppStateAction(msg.Action) {
+					slog.Debug("App service container event", "action", msg.Action,
+						"service", msg.Actor.Attributes[compose.ServiceLabel])
+					m.trigger()
+				}
+			case err := <-errs:
+				slog.Debug("Docker events stream failed; reconnecting", "error", err, "in", dockerEventsRetryInterval)
+				break events
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(dockerEventsRetryInterval):
+			// Events could have been missed while the stream was down
+			m.trigger()
+		}
+	}
+}
+
+func isAppStateAction(action dockerevents.Action) bool {
+	return appStateActions[action] || strings.HasPrefix(string(action), string(dockerevents.ActionHealthStatus))
+}
@@ -0,0 +1,139 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateLogs(t *testing.T) {
+	logs := "line 1\nline 2\nline 3\n"
+	require.Equal(t, logs, truncateLogs(logs, 0))
+	require.Equal(t, logs, truncateLogs(logs, len(logs)))
+	// The tail is kept, starting from the beginning of a line
+	require.Equal(t, "...\nline 3\n", truncateLogs(logs, 12))
+	require.Equal(t, "...\nline 3\n", truncateLogs(logs, 14))
+	require.Equal(t, "...\nline 2\nline 3\n", truncateLogs(logs, 18))
+	require.Equal(t, "...\n0123\n", truncateLogs("0123456789\n0123\n", 9))
+	// A single line longer than the limit is cut
+	require.Equal(t, "...\n789\n", truncateLogs("0123456789\n", 8))
+	require.Equal(t, "89", truncateLogs("0123456789", 2))
+	require.LessOrEqual(t, len(truncateLogs("0123456789", 8)), 8)
+}
+
+func TestNeedsLogs(t *testing.T) {
+	require.False(t, needsLogs(&AppServiceState{State: "running", Health: "healthy"}))
+	require.True(t, needsLogs(&AppServiceState{State: "running", Health: "unhealthy"}))
+	require.True(t, needsLogs(&AppServiceState{State: "exited", Health: "healthy"}))
+	require.True(t, needsLogs(&AppServiceState{State: "restarting", Health: "starting"}))
+}
+
+func TestWithoutServiceLogs(t *testing.T) {
+	states := map[string]AppState{
+		"app-1": {
+			Uri:   "hub.foundries.io/factory/app-1@sha256:01",
+			State: "unhealthy",
+			Services: []AppServiceState{
+				{Name: "srv-1", Hash: "h1", State: "running", Health: "healthy"},
+				{Name: "srv-2", Hash: "h2", State: "exited", Logs: "panic: out of memory\n"},
+			},
+		},
+	}
+	stripped := withoutServiceLogs(states)
+	require.True(t, areAppStatesEqual(states, stripped))
+	require.Empty(t, stripped["app-1"].Services[1].Logs)
+	b, err := json.Marshal(stripped)
+	require.Nil(t, err)
+	require.NotContains(t, string(b), "logs")
+	// The reported states are not changed
+	require.Equal(t, "panic: out of memory\n", states["app-1"].Services[1].Logs)
+}
+
+func TestReportAppStates_Concurrently(t *testing.T) {
+	var requests atomic.Int32
+	received := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			close(received)
+			<-release
+		}
+	}))
+	defer srv.Close()
+	gw, _ := newRetryTestClient(t, 0, srv.URL)
+	gw.lastAppStatesFile = filepath.Join(t.TempDir(), ".last-app-states")
+	states := func(state string) map[string]AppState {
+		return map[string]AppState{"app-1": {Uri: "hub.foundries.io/factory/app-1@sha256:01", State: state}}
+	}
+
+	// The post of the older states is in progress, it does not block reporting the newer ones
+	errChan := make(chan error)
+	go func() {
+		errChan <- gw.reportAppStates(context.Background(), nil, 1, states("unhealthy"))
+	}()
+	<-received
+	require.True(t, gw.appStatesLock.TryLock())
+	gw.appStatesLock.Unlock()
+	require.Nil(t, gw.reportAppStates(context.Background(), nil, 2, states("healthy")))
+	require.True(t, areAppStatesEqual(states("healthy"), gw.lastAppStates))
+
+	// The older states are not saved as the last reported ones once their post completes
+	close(release)
+	require.Nil(t, <-errChan)
+	require.True(t, areAppStatesEqual(states("healthy"), gw.lastAppStates))
+	b, err := os.ReadFile(gw.lastAppStatesFile)
+	require.Nil(t, err)
+	var saved map[string]AppState
+	require.Nil(t, json.Unmarshal(b, &saved))
+	require.True(t, areAppStatesEqual(states("healthy"), saved))
+	require.Equal(t, int32(2), requests.Load())
+}
+
+func TestAreAppStatesEqual(t *testing.T) {
+	states := func(health string, status string) map[string]AppState {
+		return map[string]AppState{
+			"app-1": {
+				Uri:   "hub.foundries.io/factory/app-1@sha256:01",
+				State: "healthy",
+				Services: []AppServiceState{
+					{Name: "srv-1", Hash: "h1", State: "running", Status: "Up 1 minute", Health: "healthy"},
+					{Name: "srv-2", Hash: "h2", State: "running", Status: status, Health: health},
+				},
+			},
+		}
+	}
+	a := states("healthy", "Up 2 minutes")
+	require.True(t, areAppStatesEqual(a, states("healthy", "Up 2 minutes")))
+	// A change of the human-readable status only is not a change of the state
+	require.True(t, areAppStatesEqual(a, states("healthy", "Up 3 minutes")))
+	// A service health flip is a change even if the app state is the same
+	require.False(t, areAppStatesEqual(a, states("unhealthy", "Up 2 minutes")))
+
+	// The order of services does not matter
+	b := states("healthy", "Up 2 minutes")
+	srvs := b["app-1"].Services
+	srvs[0], srvs[1] = srvs[1], srvs[0]
+	require.True(t, areAppStatesEqual(a, b))
+
+	b["app-1"].Services[0].State = "restarting"
+	require.False(t, areAppStatesEqual(a, b))
+	require.False(t, areAppStatesEqual(a, nil))
+	require.True(t, areAppStatesEqual(nil, map[string]AppState{}))
+}
+
+func TestIsAppStateAction(t *testing.T) {
+	require.True(t, isAppStateAction("die"))
+	require.True(t, isAppStateAction("health_status: unhealthy"))
+	require.False(t, isAppStateAction("exec_start: /bin/sh -c healthcheck"))
+	require.False(t, isAppStateAction("attach"))
+}
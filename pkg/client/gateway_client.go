@@ -4,15 +4,20 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/foundriesio/fioconfig/transport"
 	"github.com/foundriesio/fioup/pkg/config"
@@ -20,24 +25,46 @@ import (
 
 type (
 	GwHttpOperations interface {
-		HttpGet(client *http.Client, url string, headers map[string]string) (*transport.HttpRes, error)
-		HttpDo(client *http.Client, method, url string, headers map[string]string, data any) (*transport.HttpRes, error)
+		HttpGet(ctx context.Context, client *http.Client, url string, headers map[string]string) (*transport.HttpRes, error)
+		HttpDo(ctx context.Context, client *http.Client, method, url string, headers map[string]string, data any) (*transport.HttpRes, error)
 	}
 
 	GatewayClient struct {
 		BaseURL    *url.URL
 		HttpClient *http.Client
-		Headers    map[string]string
+		// Headers are sent with each request, they must be changed with UpdateHeaders once the client is in use
+		Headers     map[string]string
+		headersLock sync.RWMutex
+
+		cfg               *config.Config
+		osIdentity        OSIdentity
+		osIdentityOnce    sync.Once
+		detectOSIdentity  func() OSIdentity
+		sysInfoComponents map[string]bool
 
 		lastNetInfoFile   string
 		lastSotaFile      string
 		sotaToReport      []byte
 		lastHwinfoFile    string
 		hwinfoToReport    []byte
+		hwinfoToSave      []byte
 		lastAppStatesFile string
 		lastAppStates     map[string]AppState
+		lastAppStatesSeq  uint64
+		appStatesSeq      atomic.Uint64
+		appStatesLock     sync.Mutex
+		appLogsLines      int
+		appLogsMaxSize    int
 
 		httpOperations GwHttpOperations
+		// The gateway URLs tried in order when the active one is unavailable, the first one is BaseURL
+		baseURLs   []*url.URL
+		activeURL  atomic.Int32
+		maxRetries int
+		sleep      func(context.Context, time.Duration) error
+		stats      gatewayStats
+		statsSince time.Time
+		statsFile  string
 	}
 )
 
@@ -49,14 +76,15 @@ const (
 	HeaderKeyTarget = "x-ats-target"
 )
 
+// transportHttpOperations makes a single attempt of each request, GatewayClient retries the failed ones
 type transportHttpOperations struct{}
 
-func (transportHttpOperations) HttpGet(client *http.Client, url string, headers map[string]string) (*transport.HttpRes, error) {
-	return transport.HttpGet(client, url, headers)
+func (transportHttpOperations) HttpGet(ctx context.Context, client *http.Client, url string, headers map[string]string) (*transport.HttpRes, error) {
+	return httpDoOnce(ctx, client, http.MethodGet, url, headers, nil)
 }
 
-func (transportHttpOperations) HttpDo(client *http.Client, method, url string, headers map[string]string, data any) (*transport.HttpRes, error) {
-	return transport.HttpDo(client, method, url, headers, data)
+func (transportHttpOperations) HttpDo(ctx context.Context, client *http.Client, method, url string, headers map[string]string, data any) (*transport.HttpRes, error) {
+	return httpDoOnce(ctx, client, method, url, headers, data)
 }
 
 type (
@@ -86,6 +114,9 @@ func NewGatewayClient(cfg *config.Config, apps []string, targetID string, option
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTPS HttpClient to talk to Device Gateway: %w", err)
 	}
+	// The timeout applies to each stage of a request rather than to the whole one, see newTimeoutTransport
+	client.Timeout = 0
+	client.Transport = newTimeoutTransport(client.Transport, cfg.GetGatewayTimeout())
 	headers := map[string]string{
 		"user-agent": UserAgentPrefix + "/1.0.0", // TODO: figure out version and append here
 		HeaderKeyTag: cfg.GetTag(),
@@ -99,53 +130,133 @@ func NewGatewayClient(cfg *config.Config, apps []string, targetID string, option
 
 	sota := cfg.GetStorageDir()
 	gw := &GatewayClient{
-		BaseURL:    cfg.GetServerBaseURL(),
-		HttpClient: client,
-		Headers:    headers,
+		BaseURL:           cfg.GetServerBaseURL(),
+		HttpClient:        client,
+		Headers:           headers,
+		cfg:               cfg,
+		detectOSIdentity:  func() OSIdentity { return DetectOSIdentity(cfg.GetOSIdentityCommand()) },
+		sysInfoComponents: getSysInfoComponents(cfg),
 
 		lastNetInfoFile:   filepath.Join(sota, ".last-netinfo"),
 		lastSotaFile:      filepath.Join(sota, ".last-sota"),
 		lastHwinfoFile:    filepath.Join(sota, ".last-hwinfo"),
 		lastAppStatesFile: filepath.Join(sota, ".last-app-states"),
+		appLogsLines:      cfg.GetAppLogsLines(),
+		appLogsMaxSize:    cfg.GetAppLogsMaxSize(),
 
 		httpOperations: opts.HttpOperations,
+		baseURLs:       append([]*url.URL{cfg.GetServerBaseURL()}, cfg.GetGatewayAlternateURLs()...),
+		maxRetries:     cfg.GetGatewayMaxRetries(),
+		statsSince:     time.Now(),
+		statsFile:      filepath.Join(sota, gatewayStatsFile),
 	}
 	gw.cleanupLastStateIfRequire(cfg)
 
-	gw.initSota(cfg.TomlConfig())
-	gw.initHwinfo()
 	gw.initAppStateReporter()
-	cfg.SetClientForProxy(func(method string, url string, headers map[string]string, data any) (*transport.HttpRes, error) {
-		return gw.httpOperations.HttpDo(gw.HttpClient, method, url, headers, data)
+	cfg.SetClientForProxy(func(method string, proxyURL string, headers map[string]string, data any) (*transport.HttpRes, error) {
+		// The proxy URL provider is configured with an absolute URL, so the request is retried without failover
+		return gw.doWithRetries(context.Background(), method, func(*url.URL) string { return proxyURL }, headers, data)
 	})
 	return gw, nil
 }
 
-func (c *GatewayClient) Get(resourcePath string) (*transport.HttpRes, error) {
-	return c.httpOperations.HttpGet(c.HttpClient, c.BaseURL.JoinPath(resourcePath).String(), c.Headers)
+// OSIdentity returns the identity of the running OS reported to the Device Gateway.
+// It is detected on the first call, so the clients that do not report it do not run the identity command.
+func (c *GatewayClient) OSIdentity() OSIdentity {
+	c.osIdentityOnce.Do(func() {
+		if c.detectOSIdentity != nil {
+			c.osIdentity = c.detectOSIdentity()
+		}
+	})
+	if len(c.osIdentity.Hash) == 0 {
+		return OSIdentity{Hash: unknownOSIdentityHash, Source: OSIdentitySourceUnknown}
+	}
+	return c.osIdentity
+}
+
+func (c *GatewayClient) Get(ctx context.Context, resourcePath string) (*transport.HttpRes, error) {
+	return c.do(ctx, http.MethodGet, resourcePath, c.headers(), nil)
 }
 
-func (c *GatewayClient) getJson(resourcePath string, item any) error {
-	res, err := c.Get(resourcePath)
+// GetWithHeaders is Get that sends the given headers in addition to the gateway headers,
+// e.g. the validators of a conditional request
+func (c *GatewayClient) GetWithHeaders(ctx context.Context, resourcePath string, headers map[string]string) (*transport.HttpRes, error) {
+	if len(headers) == 0 {
+		return c.Get(ctx, resourcePath)
+	}
+	allHeaders := c.headers()
+	maps.Copy(allHeaders, headers)
+	return c.do(ctx, http.MethodGet, resourcePath, allHeaders, nil)
+}
+
+func (c *GatewayClient) getJson(ctx context.Context, resourcePath string, item any) error {
+	res, err := c.Get(ctx, resourcePath)
 	if err != nil {
 		return err
 	}
 	return res.Json(item)
 }
 
-func (c *GatewayClient) Post(resourcePath string, data any) (*transport.HttpRes, error) {
-	return c.httpOperations.HttpDo(c.HttpClient, http.MethodPost, c.BaseURL.JoinPath(resourcePath).String(), c.Headers, data)
+func (c *GatewayClient) Post(ctx context.Context, resourcePath string, data any) (*transport.HttpRes, error) {
+	return c.do(ctx, http.MethodPost, resourcePath, c.headers(), data)
+}
+
+func (c *GatewayClient) Put(ctx context.Context, resourcePath string, data any) (*transport.HttpRes, error) {
+	return c.do(ctx, http.MethodPut, resourcePath, c.headers(), data)
 }
 
-func (c *GatewayClient) Put(resourcePath string, data any) (*transport.HttpRes, error) {
-	return c.httpOperations.HttpDo(c.HttpClient, http.MethodPut, c.BaseURL.JoinPath(resourcePath).String(), c.Headers, data)
+// HttpClientWithHeaders returns a copy of the gateway HTTP client that adds the gateway headers
+// to each request it sends, unless a request already sets them. The headers are read on each request,
+// so the changes made by UpdateHeaders apply to the requests sent after them.
+// It is meant for the clients that make requests to the Device Gateway on their own, e.g. the TUF client.
+func (c *GatewayClient) HttpClientWithHeaders() *http.Client {
+	client := *c.HttpClient
+	client.Transport = &headersRoundTripper{base: c.HttpClient.Transport, gw: c}
+	return &client
 }
 
+type headersRoundTripper struct {
+	base http.RoundTripper
+	gw   *GatewayClient
+}
+
+func (t *headersRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// A RoundTripper must not modify the request it is given
+	req = req.Clone(req.Context())
+	for key, value := range t.gw.headers() {
+		if req.Header.Get(key) == "" {
+			req.Header.Set(key, value)
+		}
+	}
+	return base.RoundTrip(req)
+}
+
+// UpdateHeaders sets the apps and target headers. It is safe to call it while requests are being sent.
 func (c *GatewayClient) UpdateHeaders(apps []string, targetID string) {
+	c.headersLock.Lock()
+	defer c.headersLock.Unlock()
+	if c.Headers == nil {
+		c.Headers = map[string]string{}
+	}
 	c.Headers[HeaderKeyApps] = strings.Join(apps, ",")
 	c.Headers[HeaderKeyTarget] = targetID
 }
 
+// headers returns a copy of the gateway headers, so a request can use them while they are being updated
+func (c *GatewayClient) headers() map[string]string {
+	c.headersLock.RLock()
+	defer c.headersLock.RUnlock()
+	headers := maps.Clone(c.Headers)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	return headers
+}
+
 func (c *GatewayClient) cleanupLastStateIfRequire(cfg *config.Config) {
 	_, err := os.Stat(cfg.GetDBPath())
 	if errors.Is(err, fs.ErrNotExist) {
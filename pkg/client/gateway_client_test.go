@@ -0,0 +1,290 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatewayClient_HttpClientWithHeaders(t *testing.T) {
+	var received http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	gw := &GatewayClient{
+		HttpClient: srv.Client(),
+		Headers: map[string]string{
+			HeaderKeyTag: "main",
+		},
+	}
+	client := gw.HttpClientWithHeaders()
+
+	gw.UpdateHeaders([]string{"app1", "app2"}, "intel-corei7-64-lmp-42")
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.Nil(t, err)
+	// A header set by the caller is not overridden
+	req.Header.Set(HeaderKeyTag, "devel")
+	res, err := client.Do(req)
+	require.Nil(t, err)
+	require.Nil(t, res.Body.Close())
+
+	require.Equal(t, "devel", received.Get(HeaderKeyTag))
+	require.Equal(t, "app1,app2", received.Get(HeaderKeyApps))
+	require.Equal(t, "intel-corei7-64-lmp-42", received.Get(HeaderKeyTarget))
+	require.Empty(t, req.Header.Get(HeaderKeyApps))
+}
+
+func TestGatewayClient_UpdateHeadersConcurrently(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	gw := &GatewayClient{HttpClient: srv.Client(), Headers: map[string]string{HeaderKeyTag: "main"}}
+	client := gw.HttpClientWithHeaders()
+
+	// Run with -race: the headers are updated, e.g. by an update, while the TUF client sends requests
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			gw.UpdateHeaders([]string{"app1"}, "intel-corei7-64-lmp-"+strconv.Itoa(i))
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		res, err := client.Get(srv.URL)
+		require.Nil(t, err)
+		require.Nil(t, res.Body.Close())
+	}
+	<-done
+	require.Equal(t, "intel-corei7-64-lmp-99", gw.headers()[HeaderKeyTarget])
+	require.Equal(t, "main", gw.headers()[HeaderKeyTag])
+}
+
+func TestGatewayClient_GetWithHeaders(t *testing.T) {
+	var received http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer srv.Close()
+
+	baseURL, err := url.Parse(srv.URL)
+	require.Nil(t, err)
+	gw := &GatewayClient{
+		BaseURL:    baseURL,
+		HttpClient: srv.Client(),
+		Headers: map[string]string{
+			HeaderKeyTag: "main",
+		},
+		httpOperations: transportHttpOperations{},
+	}
+	res, err := gw.GetWithHeaders(context.Background(), "/repo/targets.json", map[string]string{"If-None-Match": `"v1"`})
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotModified, res.StatusCode)
+	require.Equal(t, "main", received.Get(HeaderKeyTag))
+	// The extra headers are not added to the gateway headers
+	require.NotContains(t, gw.Headers, "If-None-Match")
+
+	res, err = gw.GetWithHeaders(context.Background(), "/repo/targets.json", nil)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Empty(t, received.Get("If-None-Match"))
+}
+
+func newRetryTestClient(t *testing.T, maxRetries int, urls ...string) (*GatewayClient, *[]time.Duration) {
+	var baseURLs []*url.URL
+	for _, u := range urls {
+		baseURL, err := url.Parse(u)
+		require.Nil(t, err)
+		baseURLs = append(baseURLs, baseURL)
+	}
+	var delays []time.Duration
+	return &GatewayClient{
+		BaseURL:        baseURLs[0],
+		HttpClient:     &http.Client{},
+		Headers:        map[string]string{},
+		httpOperations: transportHttpOperations{},
+		baseURLs:       baseURLs,
+		maxRetries:     maxRetries,
+		sleep: func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		},
+	}, &delays
+}
+
+func TestGatewayClient_Retries(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch attempts.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	gw, delays := newRetryTestClient(t, 5, srv.URL)
+	res, err := gw.Get(context.Background(), "/config")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "ok", string(res.Body))
+	require.Len(t, *delays, 3)
+	require.Equal(t, 120*time.Second, (*delays)[0])
+	require.GreaterOrEqual(t, (*delays)[1], minRetryBackoff)
+	require.LessOrEqual(t, (*delays)[2], 4*minRetryBackoff)
+	require.Equal(t, GatewayStats{Requests: 1, Retries: 3}, gw.Stats())
+
+	// A failed POST may have been processed, so it is retried only if the server rejected it
+	attempts.Store(1)
+	res, err = gw.Post(context.Background(), "/events", []byte("[]"))
+	require.Nil(t, err)
+	require.Equal(t, http.StatusBadGateway, res.StatusCode)
+	require.Equal(t, GatewayStats{Requests: 2, Retries: 4}, gw.Stats())
+
+	// The retries are limited
+	gw.maxRetries = 1
+	attempts.Store(0)
+	res, err = gw.Put(context.Background(), "/system_info/network", map[string]string{})
+	require.Nil(t, err)
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	require.Equal(t, GatewayStats{Requests: 3, Retries: 5, Failures: 1}, gw.Stats())
+}
+
+func TestGatewayClient_Failover(t *testing.T) {
+	var received []string
+	alternate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.Path)
+	}))
+	defer alternate.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unavailable.Close()
+
+	gw, delays := newRetryTestClient(t, 3, unavailable.URL, alternate.URL+"/gw")
+	res, err := gw.Post(context.Background(), "/events", []byte("[]"))
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	// The alternate URL is tried without waiting, and it is used by the next requests
+	require.Equal(t, []time.Duration{0}, *delays)
+	res, err = gw.Get(context.Background(), "/config")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, []string{"/gw/events", "/gw/config"}, received)
+	require.Equal(t, GatewayStats{Requests: 2, Retries: 1, Failovers: 1}, gw.Stats())
+}
+
+func TestGatewayClient_RetriesCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "300")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	gw, _ := newRetryTestClient(t, 5, srv.URL)
+	gw.sleep = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	started := time.Now()
+	_, err := gw.Get(ctx, "/config")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(started), 5*time.Second)
+	require.Equal(t, GatewayStats{Requests: 1, Retries: 1, Failures: 1}, gw.Stats())
+
+	// The retries do not wait for longer than the retry period, the result of the last attempt is returned
+	gw, delays := newRetryTestClient(t, 100, srv.URL)
+	res, err := gw.Get(context.Background(), "/config")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	var total time.Duration
+	for _, d := range *delays {
+		total += d
+	}
+	require.LessOrEqual(t, total, maxRetryPeriod)
+	require.Equal(t, uint64(1), gw.Stats().Failures)
+}
+
+func TestGatewayClient_RequestCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	// The request on the wire is cancelled, it is not retried
+	gw, delays := newRetryTestClient(t, 5, srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	started := time.Now()
+	_, err := gw.Get(ctx, "/repo/targets.json")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(started), 5*time.Second)
+	require.Empty(t, *delays)
+	require.Equal(t, GatewayStats{Requests: 1, Failures: 1}, gw.Stats())
+}
+
+func TestGatewayClient_StallTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 5; i++ {
+			_, _ = w.Write([]byte("0123456789"))
+			w.(http.Flusher).Flush()
+			delay := 50 * time.Millisecond
+			if r.URL.Path == "/stalled" && i == 2 {
+				delay = time.Minute
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+	}))
+	defer srv.Close()
+
+	gw, _ := newRetryTestClient(t, 0, srv.URL)
+	gw.HttpClient = &http.Client{Transport: newTimeoutTransport(nil, 200*time.Millisecond)}
+	// A download that takes longer than the timeout does not time out while it makes progress
+	res, err := gw.Get(context.Background(), "/slow")
+	require.Nil(t, err)
+	require.Len(t, res.Body, 50)
+
+	started := time.Now()
+	_, err = gw.Get(context.Background(), "/stalled")
+	require.ErrorContains(t, err, "no response data received for 200ms")
+	require.Less(t, time.Since(started), 5*time.Second)
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"0":                             0,
+		"30":                            30 * time.Second,
+		"Fri, 02 Jan 2026 03:05:05 GMT": time.Minute,
+		"Fri, 02 Jan 2026 03:00:00 GMT": 0,
+	} {
+		delay, ok := parseRetryAfter(value, now)
+		require.True(t, ok, value)
+		require.Equal(t, expected, delay, value)
+	}
+	for _, invalid := range []string{"", "soon", "1.5"} {
+		_, ok := parseRetryAfter(invalid, now)
+		require.False(t, ok, invalid)
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/foundriesio/fioconfig/transport"
+	"github.com/foundriesio/fioup/pkg/config"
+)
+
+const (
+	minRetryBackoff = 1 * time.Second
+	maxRetryBackoff = 30 * time.Second
+	// The longest Retry-After the client waits for, a server asking for more is retried after this time
+	maxRetryAfter = 5 * time.Minute
+	// The longest time the retries of a request wait for in total
+	maxRetryPeriod = 10 * time.Minute
+
+	gatewayStatsFile = ".gateway-stats"
+)
+
+type (
+	// GatewayStats counts the requests made to the Device Gateway since the client was created
+	GatewayStats struct {
+		Requests  uint64 `json:"requests"`
+		Retries   uint64 `json:"retries"`
+		Failovers uint64 `json:"failovers"`
+		Failures  uint64 `json:"failures"`
+	}
+
+	// SavedGatewayStats are the counters of the requests made by the daemon, saved after each update check
+	SavedGatewayStats struct {
+		GatewayStats
+		// Since is the time the daemon started counting the requests
+		Since time.Time `json:"since"`
+		// UpdatedAt is the time the counters were saved
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	gatewayStats struct {
+		requests  atomic.Uint64
+		retries   atomic.Uint64
+		failovers atomic.Uint64
+		failures  atomic.Uint64
+	}
+)
+
+// httpDoOnce makes a single attempt of a request the same way transport.HttpDo of fioconfig does,
+// which retries all the failed requests on its own and does not export its single attempt.
+// The retries are made by GatewayClient according to its retry policy instead.
+func httpDoOnce(ctx context.Context, client *http.Client, method, url string, headers map[string]string, data any) (*transport.HttpRes, error) {
+	var dataBytes []byte
+	if data != nil {
+		var ok bool
+		dataBytes, ok = data.([]byte)
+		if !ok {
+			// If data is not a byte array - assuming we should marshal as JSON
+			var err error
+			dataBytes, err = json.Marshal(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(dataBytes))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Add(k, v)
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Add("User-Agent", "fioconfig-client/3")
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	req.Close = true
+
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to %s: %s - %w", method, url, err)
+	}
+	defer r.Body.Close()
+	res := &transport.HttpRes{StatusCode: r.StatusCode, Header: r.Header}
+	if res.Body, err = io.ReadAll(r.Body); err != nil {
+		return res, fmt.Errorf("Unable to read response from %s: %w", url, err)
+	}
+	return res, nil
+}
+
+// Stats returns the counters of the requests made to the Device Gateway
+func (c *GatewayClient) Stats() GatewayStats {
+	return GatewayStats{
+		Requests:  c.stats.requests.Load(),
+		Retries:   c.stats.retries.Load(),
+		Failovers: c.stats.failovers.Load(),
+		Failures:  c.stats.failures.Load(),
+	}
+}
+
+// SaveStats saves the counters of the requests so they can be read by other processes, see ReadGatewayStats
+func (c *GatewayClient) SaveStats() error {
+	b, err := json.Marshal(SavedGatewayStats{GatewayStats: c.Stats(), Since: c.statsSince, UpdatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.statsFile, b, 0o644)
+}
+
+// ReadGatewayStats returns the counters of the requests last saved by the daemon, or nil if there are none
+func ReadGatewayStats(cfg *config.Config) (*SavedGatewayStats, error) {
+	b, err := os.ReadFile(filepath.Join(cfg.GetStorageDir(), gatewayStatsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var stats SavedGatewayStats
+	if err := json.Unmarshal(b, &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse Device Gateway request counters: %w", err)
+	}
+	return &stats, nil
+}
+
+// do sends a request to the given resource of the Device Gateway, see doWithRetries
+func (c *GatewayClient) do(ctx context.Context, method, resourcePath string, headers map[string]string, data any) (*transport.HttpRes, error) {
+	return c.doWithRetries(ctx, method, func(base *url.URL) string {
+		return base.JoinPath(resourcePath).String()
+	}, headers, data)
+}
+
+// doWithRetries sends a request and retries it with a jittered exponential backoff if it failed transiently.
+// Idempotent requests are retried on connection errors, server errors and throttling. Other requests are retried
+// only if the server did not process them: on throttling, 503 or if the connection could not be established.
+// If the gateway is unavailable, the next attempt is made to the next gateway URL, which is used by the following
+// requests too once it responds.
+// The retries stop when the context is done, or return the result of the last attempt once the waiting
+// between them would exceed maxRetryPeriod.
+func (c *GatewayClient) doWithRetries(ctx context.Context, method string, urlFor func(base *url.URL) string,
+	headers map[string]string, data any) (*transport.HttpRes, error) {
+	c.stats.requests.Add(1)
+	var waited time.Duration
+	baseURLs := c.baseURLs
+	if len(baseURLs) == 0 {
+		baseURLs = []*url.URL{c.BaseURL}
+	}
+	sleep := c.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	ops := c.httpOperations
+	if ops == nil {
+		ops = transportHttpOperations{}
+	}
+	for attempt := 0; ; attempt++ {
+		urlIndex := int(c.activeURL.Load()) % len(baseURLs)
+		reqURL := urlFor(baseURLs[urlIndex])
+		var res *transport.HttpRes
+		var err error
+		if method == http.MethodGet {
+			res, err = ops.HttpGet(ctx, c.HttpClient, reqURL, headers)
+		} else {
+			res, err = ops.HttpDo(ctx, c.HttpClient, method, reqURL, headers, data)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			c.stats.failures.Add(1)
+			return nil, fmt.Errorf("request to %s cancelled: %w", reqURL, ctxErr)
+		}
+		retry, failover := shouldRetry(method, res, err)
+		failover = failover && len(baseURLs) > 1
+		delay := retryDelay(attempt, res)
+		if failover && attempt < len(baseURLs)-1 {
+			// Try each of the gateway URLs without waiting first
+			delay = 0
+		}
+		if retry && (attempt >= c.maxRetries || waited+delay > maxRetryPeriod) {
+			c.stats.failures.Add(1)
+			retry = false
+		}
+		if !retry {
+			return res, err
+		}
+
+		if failover {
+			c.activeURL.CompareAndSwap(int32(urlIndex), int32((urlIndex+1)%len(baseURLs)))
+			c.stats.failovers.Add(1)
+		}
+		c.stats.retries.Add(1)
+		status := 0
+		if res != nil {
+			status = res.StatusCode
+		}
+		slog.Debug("Device Gateway request failed, retrying", "method", method, "url", reqURL, "status", status,
+			"error", err, "attempt", attempt+1, "delay", delay, "failover", failover,
+			"total_retries", c.stats.retries.Load(), "total_failovers", c.stats.failovers.Load())
+		waited += delay
+		if ctxErr := sleep(ctx, delay); ctxErr != nil {
+			c.stats.failures.Add(1)
+			return nil, fmt.Errorf("request to %s cancelled while retrying: %w", reqURL, ctxErr)
+		}
+	}
+}
+
+// newTimeoutTransport returns the transport of the Device Gateway client with the given timeout of establishing
+// a connection, of receiving the response headers and of each wait for the response body data.
+// Unlike http.Client.Timeout, it does not limit the duration of the whole request, so a large download
+// over a slow link, e.g. of the targets metadata, does not time out as long as it makes progress.
+func newTimeoutTransport(base http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	if timeout <= 0 {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t, ok := base.(*http.Transport); ok {
+		t = t.Clone()
+		t.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+		t.TLSHandshakeTimeout = timeout
+		t.ResponseHeaderTimeout = timeout
+		base = t
+	}
+	return &stallTimeoutRoundTripper{base: base, timeout: timeout}
+}
+
+// stallTimeoutRoundTripper cancels a request if no response body data is received for the timeout
+type stallTimeoutRoundTripper struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *stallTimeoutRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	res, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	body := &stallTimeoutBody{ReadCloser: res.Body, timeout: t.timeout, cancel: cancel}
+	body.timer = time.AfterFunc(t.timeout, body.stall)
+	res.Body = body
+	return res, nil
+}
+
+type stallTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	stalled atomic.Bool
+}
+
+func (b *stallTimeoutBody) stall() {
+	b.stalled.Store(true)
+	b.cancel()
+}
+
+func (b *stallTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && b.stalled.Load() {
+		return n, fmt.Errorf("no response data received for %s: %w", b.timeout, err)
+	}
+	b.timer.Reset(b.timeout)
+	return n, err
+}
+
+func (b *stallTimeoutBody) Close() error {
+	b.timer.Stop()
+	b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// sleepContext waits for the given time unless the context is done first, in which case its error is returned
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// shouldRetry returns whether a request should be retried, and whether the gateway is unavailable,
+// so the request should be retried with the alternate gateway URL
+func shouldRetry(method string, res *transport.HttpRes, err error) (retry bool, failover bool) {
+	idempotent := isIdempotent(method)
+	if err != nil {
+		var opErr *net.OpError
+		notSent := errors.As(err, &opErr) && opErr.Op == "dial"
+		return idempotent || notSent, true
+	}
+	switch {
+	case res == nil:
+		return false, false
+	case res.StatusCode == http.StatusTooManyRequests:
+		return true, false
+	case res.StatusCode == http.StatusServiceUnavailable:
+		return true, true
+	case res.StatusCode >= 500:
+		return idempotent, idempotent
+	}
+	return false, false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns the delay before the next attempt: the exponential backoff with a random jitter,
+// so many devices do not retry at the same moment, or the time the server asked to wait for in Retry-After
+func retryDelay(attempt int, res *transport.HttpRes) time.Duration {
+	backoff := min(minRetryBackoff<<min(attempt, 16), maxRetryBackoff)
+	delay := backoff/2 + rand.N(backoff/2+1)
+	if res != nil {
+		if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+			delay = max(delay, min(retryAfter, maxRetryAfter))
+		}
+	}
+	return delay
+}
+
+// parseRetryAfter parses the Retry-After header value, which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,172 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OSIdentitySourceCommand   = "command"
+	OSIdentitySourceOstree    = "ostree"
+	OSIdentitySourceOSRelease = "os-release"
+	OSIdentitySourceUnknown   = "unknown"
+
+	// Hash reported if the OS identity cannot be detected, it is the hash of the empty string
+	unknownOSIdentityHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	osIdentityCommandTimeout = 10 * time.Second
+)
+
+type (
+	// OSIdentity identifies the OS build the device runs
+	OSIdentity struct {
+		Hash      string `json:"hash"`
+		Source    string `json:"source"`
+		Name      string `json:"name,omitempty"`
+		VersionID string `json:"version_id,omitempty"`
+		BuildID   string `json:"build_id,omitempty"`
+	}
+)
+
+var (
+	// The root of the filesystem the OS identity is detected from, overridden in tests
+	osRootDir      = "/"
+	osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+	sha256HexRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// DetectOSIdentity returns the identity of the running OS. If the command is specified, the identity is
+// the command output, or its hash if the output is not a hash itself. Otherwise, it is the checksum of the booted
+// ostree deployment on ostree-based systems, or the hash of the OS version and build ID found in os-release.
+func DetectOSIdentity(command string) OSIdentity {
+	identity := OSIdentity{Hash: unknownOSIdentityHash, Source: OSIdentitySourceUnknown}
+	osRelease, err := readOSRelease()
+	if err != nil {
+		slog.Debug("failed to read os-release", "error", err)
+	}
+	identity.Name = osRelease["PRETTY_NAME"]
+	identity.VersionID = osRelease["VERSION_ID"]
+	identity.BuildID = osRelease["BUILD_ID"]
+
+	if len(command) > 0 {
+		hash, err := runOSIdentityCommand(command)
+		if err == nil {
+			identity.Hash = hash
+			identity.Source = OSIdentitySourceCommand
+			return identity
+		}
+		slog.Warn("failed to get OS identity with the configured command", "command", command, "error", err)
+	}
+	hash, err := ostreeDeploymentChecksum()
+	if err == nil {
+		identity.Hash = hash
+		identity.Source = OSIdentitySourceOstree
+		return identity
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		slog.Debug("failed to get booted ostree deployment", "error", err)
+	}
+	if len(identity.VersionID) > 0 || len(identity.BuildID) > 0 {
+		id := fmt.Sprintf("ID=%s\nVERSION_ID=%s\nBUILD_ID=%s\n", osRelease["ID"], identity.VersionID, identity.BuildID)
+		identity.Hash = sha256Hex([]byte(id))
+		identity.Source = OSIdentitySourceOSRelease
+	}
+	return identity
+}
+
+// ostreeDeploymentChecksum returns the commit checksum of the booted ostree deployment. The deployment is found
+// by the `ostree=` kernel argument, which is a symlink to the deployment directory named `<checksum>.<serial>`.
+func ostreeDeploymentChecksum() (string, error) {
+	if _, err := os.Stat(filepath.Join(osRootDir, "ostree")); err != nil {
+		return "", err
+	}
+	cmdline, err := os.ReadFile(filepath.Join(osRootDir, "proc/cmdline"))
+	if err != nil {
+		return "", err
+	}
+	var bootPath string
+	for _, arg := range strings.Fields(string(cmdline)) {
+		if value, ok := strings.CutPrefix(arg, "ostree="); ok {
+			bootPath = value
+		}
+	}
+	if len(bootPath) == 0 {
+		return "", errors.New("no ostree kernel argument found")
+	}
+	deployPath, err := filepath.EvalSymlinks(filepath.Join(osRootDir, bootPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve ostree boot path %s: %w", bootPath, err)
+	}
+	checksum, serial, _ := strings.Cut(filepath.Base(deployPath), ".")
+	if _, err := strconv.Atoi(serial); err != nil || !sha256HexRegex.MatchString(checksum) {
+		return "", fmt.Errorf("unexpected ostree deployment path: %s", deployPath)
+	}
+	return checksum, nil
+}
+
+func readOSRelease() (map[string]string, error) {
+	var err error
+	for _, path := range osReleasePaths {
+		var f *os.File
+		if f, err = os.Open(filepath.Join(osRootDir, path)); err != nil {
+			continue
+		}
+		defer f.Close()
+		values := map[string]string{}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if key, value, ok := strings.Cut(line, "="); ok {
+				if unquoted, err := strconv.Unquote(value); err == nil {
+					value = unquoted
+				} else {
+					value = strings.Trim(value, `'"`)
+				}
+				values[key] = value
+			}
+		}
+		return values, scanner.Err()
+	}
+	return nil, err
+}
+
+func runOSIdentityCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), osIdentityCommandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "/bin/sh", "-c", command).Output()
+	if err != nil {
+		return "", err
+	}
+	id := strings.TrimSpace(string(output))
+	if len(id) == 0 {
+		return "", errors.New("empty output")
+	}
+	if sha256HexRegex.MatchString(id) {
+		return id, nil
+	}
+	return sha256Hex([]byte(id)), nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
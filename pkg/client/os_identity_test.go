@@ -0,0 +1,98 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setOSRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	prevRoot := osRootDir
+	osRootDir = root
+	t.Cleanup(func() { osRootDir = prevRoot })
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "etc"), 0o755))
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "proc"), 0o755))
+	osRelease := `ID=lmp
+PRETTY_NAME="Linux-microPlatform 4.0.20"
+VERSION_ID="4.0.20"
+BUILD_ID='42'
+`
+	require.Nil(t, os.WriteFile(filepath.Join(root, "etc/os-release"), []byte(osRelease), 0o644))
+	return root
+}
+
+func TestDetectOSIdentity_OSRelease(t *testing.T) {
+	setOSRoot(t)
+	identity := DetectOSIdentity("")
+	require.Equal(t, OSIdentitySourceOSRelease, identity.Source)
+	require.Equal(t, "Linux-microPlatform 4.0.20", identity.Name)
+	require.Equal(t, "4.0.20", identity.VersionID)
+	require.Equal(t, "42", identity.BuildID)
+	require.Equal(t, sha256Hex([]byte("ID=lmp\nVERSION_ID=4.0.20\nBUILD_ID=42\n")), identity.Hash)
+}
+
+func TestDetectOSIdentity_Ostree(t *testing.T) {
+	root := setOSRoot(t)
+	checksum := strings.Repeat("ab", 32)
+	bootCsum := strings.Repeat("cd", 32)
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "ostree/deploy/lmp/deploy", checksum+".1"), 0o755))
+	require.Nil(t, os.MkdirAll(filepath.Join(root, "ostree/boot.0/lmp", bootCsum), 0o755))
+	require.Nil(t, os.Symlink("../../../deploy/lmp/deploy/"+checksum+".1",
+		filepath.Join(root, "ostree/boot.0/lmp", bootCsum, "0")))
+	cmdline := "root=LABEL=otaroot rootfstype=ext4 ostree=/ostree/boot.0/lmp/" + bootCsum + "/0 console=ttyS0\n"
+	require.Nil(t, os.WriteFile(filepath.Join(root, "proc/cmdline"), []byte(cmdline), 0o644))
+
+	identity := DetectOSIdentity("")
+	require.Equal(t, OSIdentitySourceOstree, identity.Source)
+	require.Equal(t, checksum, identity.Hash)
+	require.Equal(t, "4.0.20", identity.VersionID)
+
+	// Falls back to os-release if the system is not booted from an ostree deployment
+	require.Nil(t, os.WriteFile(filepath.Join(root, "proc/cmdline"), []byte("root=/dev/sda1\n"), 0o644))
+	require.Equal(t, OSIdentitySourceOSRelease, DetectOSIdentity("").Source)
+}
+
+func TestDetectOSIdentity_Command(t *testing.T) {
+	setOSRoot(t)
+	identity := DetectOSIdentity("echo build-1234")
+	require.Equal(t, OSIdentitySourceCommand, identity.Source)
+	require.Equal(t, sha256Hex([]byte("build-1234")), identity.Hash)
+
+	checksum := strings.Repeat("01", 32)
+	require.Equal(t, checksum, DetectOSIdentity("echo "+checksum).Hash)
+
+	// Falls back to the detected identity if the command fails
+	require.Equal(t, OSIdentitySourceOSRelease, DetectOSIdentity("exit 1").Source)
+}
+
+func TestDetectOSIdentity_Unknown(t *testing.T) {
+	root := setOSRoot(t)
+	require.Nil(t, os.Remove(filepath.Join(root, "etc/os-release")))
+	identity := DetectOSIdentity("")
+	require.Equal(t, OSIdentitySourceUnknown, identity.Source)
+	require.Equal(t, unknownOSIdentityHash, identity.Hash)
+	require.Equal(t, sha256Hex(nil), identity.Hash)
+}
+
+func TestGatewayClient_OSIdentityIsDetectedOnce(t *testing.T) {
+	detected := 0
+	gw := GatewayClient{detectOSIdentity: func() OSIdentity {
+		detected++
+		return OSIdentity{Hash: sha256Hex([]byte("build-42")), Source: OSIdentitySourceCommand}
+	}}
+	require.Equal(t, 0, detected)
+	require.Equal(t, OSIdentitySourceCommand, gw.OSIdentity().Source)
+	require.Equal(t, OSIdentitySourceCommand, gw.OSIdentity().Source)
+	require.Equal(t, 1, detected)
+
+	// The clients created without detection report the unknown identity
+	require.Equal(t, unknownOSIdentityHash, (&GatewayClient{}).OSIdentity().Hash)
+}
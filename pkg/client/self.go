@@ -4,6 +4,7 @@
 package client
 
 import (
+	"context"
 	"time"
 )
 
@@ -24,7 +25,7 @@ type Device struct {
 	Tag       string      `json:"tag"`
 }
 
-func (c *GatewayClient) Self() (*Device, error) {
+func (c *GatewayClient) Self(ctx context.Context) (*Device, error) {
 	var d Device
-	return &d, c.getJson("/device", &d)
+	return &d, c.getJson(ctx, "/device", &d)
 }
@@ -3,19 +3,83 @@
 
 package client
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"github.com/foundriesio/fioup/pkg/config"
+)
+
+// Components of the system information reported to the Device Gateway, each of them can be disabled in the config
+const (
+	SysInfoNetwork          = "network"           // hostname and network interfaces
+	SysInfoConfig           = "config"            // combined sota.toml
+	SysInfoHwinfo           = "hwinfo"            // hardware information
+	SysInfoStorage          = "storage"           // disk usage of the app store
+	SysInfoDocker           = "docker"            // Docker engine version and storage driver
+	SysInfoContainerRuntime = "container_runtime" // container runtimes available to Docker
+	SysInfoKernel           = "kernel"            // kernel version
+	SysInfoUptime           = "uptime"            // boot time and uptime
+	SysInfoCollectors       = "collectors"        // output of the collector scripts
+)
+
+var sysInfoComponents = []string{
+	SysInfoNetwork,
+	SysInfoConfig,
+	SysInfoHwinfo,
+	SysInfoStorage,
+	SysInfoDocker,
+	SysInfoContainerRuntime,
+	SysInfoKernel,
+	SysInfoUptime,
+	SysInfoCollectors,
+}
+
+// getSysInfoComponents returns the set of system information components enabled in the config
+func getSysInfoComponents(cfg *config.Config) map[string]bool {
+	components := map[string]bool{}
+	if !cfg.GetSysInfoEnabled() {
+		return components
+	}
+	disabled := cfg.GetSysInfoDisabledComponents()
+	for _, name := range disabled {
+		if !slices.Contains(sysInfoComponents, name) {
+			slog.Warn("unknown system information component in config", "key", config.SysInfoDisabledKey, "component", name)
+		}
+	}
+	for _, name := range sysInfoComponents {
+		if !slices.Contains(disabled, name) {
+			components[name] = true
+		}
+	}
+	return components
+}
 
 // PutSysInfo sends the "system-info" API data to the gateway. It only sends
 // each piece of data if it has changed since the last time this function
-// was invoked.
-func (c *GatewayClient) PutSysInfo() error {
-	err := c.uploadNetInfo()
+// was invoked. The data is collected on each call, unless the reporting is disabled.
+func (c *GatewayClient) PutSysInfo(ctx context.Context) error {
+	if len(c.sysInfoComponents) == 0 {
+		slog.Debug("System information reporting is disabled")
+		return nil
+	}
+	if c.sysInfoComponents[SysInfoConfig] {
+		c.initSota(c.cfg.TomlConfig(), c.cfg.GetSysInfoRedactPatterns())
+	}
+	c.initHwinfo(c.cfg)
+
+	var err error
+	if c.sysInfoComponents[SysInfoNetwork] {
+		err = c.uploadNetInfo(ctx)
+	}
 
-	if err2 := c.uploadSotaToml(); err2 != nil {
+	if err2 := c.uploadSotaToml(ctx); err2 != nil {
 		err = errors.Join(err, err2)
 	}
 
-	if err2 := c.uploadHwinfo(); err2 != nil {
+	if err2 := c.uploadHwinfo(ctx); err2 != nil {
 		err = errors.Join(err, err2)
 	}
 
@@ -5,23 +5,28 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"os/exec"
+	"strings"
+
+	"github.com/foundriesio/fioup/pkg/config"
 )
 
-// uploadHwinfo uploads the output of `lshw` IFF its changed.
-func (c *GatewayClient) uploadHwinfo() error {
+// uploadHwinfo uploads the hardware info IFF its changed.
+func (c *GatewayClient) uploadHwinfo(ctx context.Context) error {
 	if c.hwinfoToReport == nil {
 		slog.Debug("Hardware-info has not changed")
 		return nil
 	}
 	headers := map[string]string{"Content-type": "application/json"}
-	url := c.BaseURL.JoinPath("/system_info").String()
-	res, err := c.httpOperations.HttpDo(c.HttpClient, http.MethodPut, url, headers, c.hwinfoToReport)
+	res, err := c.do(ctx, http.MethodPut, "/system_info", headers, c.hwinfoToReport)
 	if err != nil {
 		return err
 	}
@@ -29,7 +34,8 @@ func (c *GatewayClient) uploadHwinfo() error {
 		return fmt.Errorf("unable to update hwinfo info. HTTP_%d: %s", res.StatusCode, res.String())
 	}
 
-	toSave := c.hwinfoToReport
+	// The info without its volatile values is saved, it is what the next collected info is compared to
+	toSave := c.hwinfoToSave
 	c.hwinfoToReport = nil // no matter what happens below - don't re-publish
 
 	if err := os.WriteFile(c.lastHwinfoFile, toSave, 0o744); err != nil {
@@ -41,60 +47,122 @@ func (c *GatewayClient) uploadHwinfo() error {
 
 // scrubHwInfo looks at fields known to change for each call of `lshw` and cleans
 // them up so that we don't report every single change to the backend but only
-// major ones.
-func scrubHwinfo(lshwBytes []byte) []byte {
+// major ones. An error is returned if the output is not a hardware info object.
+func scrubHwinfo(lshwBytes []byte) ([]byte, error) {
 	var hwInfo map[string]any
 	if err := json.Unmarshal(lshwBytes, &hwInfo); err != nil {
-		slog.Error("Unexpected error unmarshalling lshw output", "error", err)
+		// Newer versions of lshw print the info as a list of one object
+		var hwInfoList []map[string]any
+		if errList := json.Unmarshal(lshwBytes, &hwInfoList); errList != nil || len(hwInfoList) != 1 {
+			return nil, fmt.Errorf("unexpected lshw output: %w", err)
+		}
+		hwInfo = hwInfoList[0]
+	}
+	if hwInfo == nil {
+		return nil, errors.New("unexpected lshw output: null")
 	}
 
 	// cpu frequency (cpu "size") is always changing. The actual capacity is
 	// the more interesting value, so just remove this attribute
-	children := hwInfo["children"].([]any)
-	for _, child := range children {
-		child := child.(map[string]any)
-		if child["id"].(string) == "core" {
-			children := child["children"].([]any)
-			for _, child := range children {
-				child := child.(map[string]any)
-				if child["id"].(string) == "cpu" {
-					if _, ok := child["size"]; ok {
-						slog.Debug("Deleting CPU frequency from lshw output", "freq", child["size"])
-						delete(child, "size")
-						break
-					}
+	for _, core := range hwinfoChildren(hwInfo) {
+		if core["id"] != "core" {
+			continue
+		}
+		for _, cpu := range hwinfoChildren(core) {
+			if id, _ := cpu["id"].(string); id == "cpu" || strings.HasPrefix(id, "cpu:") {
+				if _, ok := cpu["size"]; ok {
+					slog.Debug("Deleting CPU frequency from lshw output", "id", id, "freq", cpu["size"])
+					delete(cpu, "size")
 				}
 			}
-			break
 		}
+		break
 	}
 
 	output, err := json.Marshal(hwInfo)
 	if err != nil {
-		slog.Error("Unexpected error marshalling lshw data", "error", err)
-		output = lshwBytes // this is the best we can do - don't scrub, the output
+		return nil, fmt.Errorf("unexpected error marshalling lshw data: %w", err)
 	}
+	return output, nil
+}
 
-	return output
+// hwinfoChildren returns the child nodes of the given hardware info node, the nodes of unexpected types are skipped
+func hwinfoChildren(node map[string]any) []map[string]any {
+	list, _ := node["children"].([]any)
+	children := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		if child, ok := item.(map[string]any); ok {
+			children = append(children, child)
+		}
+	}
+	return children
 }
 
-func (c *GatewayClient) initHwinfo() {
+// lshwInfo returns the scrubbed output of `lshw`
+func lshwInfo() ([]byte, error) {
 	path, err := exec.LookPath("lshw")
 	if err != nil {
-		slog.Debug("lshw not available. Will not publish hardware-info")
+		return nil, fmt.Errorf("lshw not available: %w", err)
 	}
-
 	cmd := exec.Command(path, "-json", "-notime")
 	output, err := cmd.Output()
 	if err != nil {
-		slog.Error("Unable to run lshw", "error", err)
+		return nil, fmt.Errorf("unable to run lshw: %w", err)
+	}
+	return scrubHwinfo(output)
+}
+
+// initHwinfo collects the system information reported as the hardware info: the output of `lshw`,
+// the identity of the running OS and the enabled runtime components, e.g. Docker engine and kernel versions.
+func (c *GatewayClient) initHwinfo(cfg *config.Config) {
+	info := map[string]any{}
+	if c.sysInfoComponents[SysInfoHwinfo] {
+		lshw, err := lshwInfo()
+		if err == nil {
+			err = json.Unmarshal(lshw, &info)
+		}
+		if err != nil || info == nil {
+			slog.Info("Unable to get hardware-info with lshw, falling back to the built-in collector", "error", err)
+			info = builtinHwinfo()
+		}
+	}
+	runtimeInfo := getRuntimeSysInfo(c.sysInfoComponents, cfg.ComposeConfig(), cfg.GetSysInfoCollectorsDir())
+	if len(info) == 0 && len(runtimeInfo) == 0 {
+		slog.Debug("No hardware-info to publish")
+		return
+	}
+	maps.Copy(info, runtimeInfo)
+	// The OS identity is a part of any hardware info, so the backend can tell which OS build the device runs
+	info["os_identity"] = c.OSIdentity()
+
+	output, err := json.Marshal(info)
+	if err != nil {
+		slog.Error("Unexpected error marshalling hardware-info", "error", err)
+		return
+	}
+	stable, err := stableHwinfo(info)
+	if err != nil {
+		slog.Error("Unexpected error marshalling hardware-info", "error", err)
 		return
 	}
-	output = scrubHwinfo(output)
 
+	c.hwinfoToReport = nil
 	reported, err := os.ReadFile(c.lastHwinfoFile)
-	if err == nil && bytes.Equal(reported, output) {
+	if err == nil && bytes.Equal(reported, stable) {
 		return
 	}
 	c.hwinfoToReport = output // Lets uploadHwInfo know to publish
+	c.hwinfoToSave = stable
+}
+
+// stableHwinfo returns the hardware info without the values that change on each collection, e.g. the uptime
+// and the used storage. It is what is compared to find out if the info has changed, so these values are
+// reported along with the other changes but do not make the info uploaded on their own.
+func stableHwinfo(info map[string]any) ([]byte, error) {
+	stable := maps.Clone(info)
+	delete(stable, SysInfoUptime)
+	if storage, ok := stable[SysInfoStorage].(*storageInfo); ok {
+		stable[SysInfoStorage] = storageInfo{Path: storage.Path, FsBytes: storage.FsBytes}
+	}
+	return json.Marshal(stable)
 }
@@ -0,0 +1,249 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Virtual block devices that are not reported as disks
+var virtualBlockDevicePrefixes = []string{"loop", "ram", "zram", "dm-", "md", "nbd", "sr"}
+
+// builtinHwinfo collects the hardware info from procfs and sysfs when `lshw` is not available.
+// The info follows the schema of the `lshw -json` output, so the backend handles both the same way:
+// the system node with the core (motherboard) node holding the cpu, memory and disk nodes.
+func builtinHwinfo() map[string]any {
+	system := map[string]any{
+		"id":          "",
+		"class":       "system",
+		"description": "Computer",
+	}
+	if host, err := os.Hostname(); err == nil {
+		system["id"] = host
+	}
+	setIfNotEmpty(system, "product", readSysValue("sys/class/dmi/id/product_name"))
+	setIfNotEmpty(system, "vendor", readSysValue("sys/class/dmi/id/sys_vendor"))
+	setIfNotEmpty(system, "version", readSysValue("sys/class/dmi/id/product_version"))
+	setIfNotEmpty(system, "serial", readSysValue("sys/class/dmi/id/product_serial"))
+	if _, ok := system["product"]; !ok {
+		// Devices without DMI, e.g. ARM boards, describe themselves in the device tree
+		model := readSysValue("proc/device-tree/model")
+		if len(model) == 0 {
+			model = readSysValue("sys/firmware/devicetree/base/model")
+		}
+		setIfNotEmpty(system, "product", model)
+	}
+
+	core := map[string]any{
+		"id":          "core",
+		"class":       "bus",
+		"description": "Motherboard",
+	}
+	setIfNotEmpty(core, "product", readSysValue("sys/class/dmi/id/board_name"))
+	setIfNotEmpty(core, "vendor", readSysValue("sys/class/dmi/id/board_vendor"))
+	setIfNotEmpty(core, "version", readSysValue("sys/class/dmi/id/board_version"))
+
+	var children []any
+	if firmware := firmwareNode(); firmware != nil {
+		children = append(children, firmware)
+	}
+	if cpu := cpuNode(); cpu != nil {
+		children = append(children, cpu)
+	}
+	if memory := memoryNode(); memory != nil {
+		children = append(children, memory)
+	}
+	for _, disk := range diskNodes() {
+		children = append(children, disk)
+	}
+	if len(children) > 0 {
+		core["children"] = children
+	}
+	system["children"] = []any{core}
+	return system
+}
+
+func firmwareNode() map[string]any {
+	vendor := readSysValue("sys/class/dmi/id/bios_vendor")
+	version := readSysValue("sys/class/dmi/id/bios_version")
+	if len(vendor) == 0 && len(version) == 0 {
+		return nil
+	}
+	node := map[string]any{
+		"id":          "firmware",
+		"class":       "memory",
+		"description": "BIOS",
+	}
+	setIfNotEmpty(node, "vendor", vendor)
+	setIfNotEmpty(node, "version", version)
+	setIfNotEmpty(node, "date", readSysValue("sys/class/dmi/id/bios_date"))
+	return node
+}
+
+// cpuNode describes the CPU found in /proc/cpuinfo. Its format differs between architectures, e.g. x86 has
+// "model name" and "vendor_id" for each processor while ARM may have only the "CPU implementer" and "CPU part".
+func cpuNode() map[string]any {
+	f, err := os.Open(filepath.Join(osRootDir, "proc/cpuinfo"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	values := map[string]string{}
+	threads := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if key == "processor" {
+			threads++
+			continue
+		}
+		if _, found := values[key]; !found && len(value) > 0 {
+			values[key] = value
+		}
+	}
+	if threads == 0 && len(values) == 0 {
+		return nil
+	}
+	node := map[string]any{
+		"id":          "cpu",
+		"class":       "processor",
+		"description": "CPU",
+	}
+	product := firstNonEmpty(values["model name"], values["cpu model"], values["Processor"], values["cpu"])
+	if len(product) == 0 && len(values["CPU part"]) > 0 {
+		product = fmt.Sprintf("implementer %s part %s", values["CPU implementer"], values["CPU part"])
+	}
+	setIfNotEmpty(node, "product", product)
+	setIfNotEmpty(node, "vendor", firstNonEmpty(values["vendor_id"], cpuImplementer(values["CPU implementer"])))
+	if threads > 0 {
+		node["configuration"] = map[string]any{"threads": strconv.Itoa(threads)}
+	}
+	return node
+}
+
+// cpuImplementer returns the name of a well-known ARM CPU implementer
+func cpuImplementer(id string) string {
+	switch strings.ToLower(id) {
+	case "0x41":
+		return "ARM"
+	case "0x42":
+		return "Broadcom"
+	case "0x43":
+		return "Cavium"
+	case "0x48":
+		return "HiSilicon"
+	case "0x4e":
+		return "NVIDIA"
+	case "0x51":
+		return "Qualcomm"
+	case "0x61":
+		return "Apple"
+	}
+	return id
+}
+
+func memoryNode() map[string]any {
+	f, err := os.Open(filepath.Join(osRootDir, "proc/meminfo"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:        8049952 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		size, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil
+		}
+		if len(fields) > 2 && strings.EqualFold(fields[2], "kB") {
+			size *= 1024
+		}
+		return map[string]any{
+			"id":          "memory",
+			"class":       "memory",
+			"description": "System Memory",
+			"units":       "bytes",
+			"size":        size,
+		}
+	}
+	return nil
+}
+
+func diskNodes() []map[string]any {
+	blockDir := filepath.Join(osRootDir, "sys/block")
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return nil
+	}
+	var disks []map[string]any
+	for _, entry := range entries {
+		name := entry.Name()
+		if slices.ContainsFunc(virtualBlockDevicePrefixes, func(prefix string) bool { return strings.HasPrefix(name, prefix) }) {
+			continue
+		}
+		// The size of block devices is in 512-byte sectors no matter the actual sector size
+		sectors, err := strconv.ParseUint(readSysValue(filepath.Join("sys/block", name, "size")), 10, 64)
+		if err != nil || sectors == 0 {
+			continue
+		}
+		disk := map[string]any{
+			"id":          fmt.Sprintf("disk:%d", len(disks)),
+			"class":       "disk",
+			"description": "Disk",
+			"logicalname": "/dev/" + name,
+			"units":       "bytes",
+			"size":        sectors * 512,
+		}
+		setIfNotEmpty(disk, "product", firstNonEmpty(
+			readSysValue(filepath.Join("sys/block", name, "device/model")),
+			readSysValue(filepath.Join("sys/block", name, "device/name"))))
+		setIfNotEmpty(disk, "vendor", readSysValue(filepath.Join("sys/block", name, "device/vendor")))
+		setIfNotEmpty(disk, "serial", readSysValue(filepath.Join("sys/block", name, "device/serial")))
+		if readSysValue(filepath.Join("sys/block", name, "removable")) == "1" {
+			disk["capabilities"] = map[string]any{"removable": "support is removable"}
+		}
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+// readSysValue returns the trimmed content of a procfs or sysfs file, or an empty string if it cannot be read
+func readSysValue(path string) string {
+	b, err := os.ReadFile(filepath.Join(osRootDir, path))
+	if err != nil {
+		return ""
+	}
+	// Device tree strings are NUL terminated
+	return strings.TrimSpace(strings.TrimRight(string(b), "\x00"))
+}
+
+func setIfNotEmpty(node map[string]any, key string, value string) {
+	if len(value) > 0 {
+		node[key] = value
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrubHwinfo(t *testing.T) {
+	lshw := `{"id":"dev","class":"system","children":[{"id":"core","class":"bus","children":[
+{"id":"cpu:0","class":"processor","size":1200000000,"capacity":3400000000},
+{"id":"cpu:1","class":"processor","size":2200000000,"capacity":3400000000},
+{"id":"memory","class":"memory","size":8589934592}]}]}`
+	expected := `{"id":"dev","class":"system","children":[{"id":"core","class":"bus","children":[
+{"id":"cpu:0","class":"processor","capacity":3400000000},
+{"id":"cpu:1","class":"processor","capacity":3400000000},
+{"id":"memory","class":"memory","size":8589934592}]}]}`
+	scrubbed, err := scrubHwinfo([]byte(lshw))
+	require.Nil(t, err)
+	require.JSONEq(t, expected, string(scrubbed))
+
+	// Newer lshw versions print a list
+	scrubbed, err = scrubHwinfo([]byte("[" + lshw + "]"))
+	require.Nil(t, err)
+	require.JSONEq(t, expected, string(scrubbed))
+
+	// Unexpected shapes are not scrubbed but must not panic
+	for _, valid := range []string{
+		`{"id":"dev"}`,
+		`{"id":"dev","children":"none"}`,
+		`{"id":"dev","children":[1,"core",{"id":"core","children":{"id":"cpu"}}]}`,
+		`{"id":"dev","children":[{"id":5,"children":[{"id":null}]}]}`,
+	} {
+		scrubbed, err := scrubHwinfo([]byte(valid))
+		require.Nil(t, err, valid)
+		require.JSONEq(t, valid, string(scrubbed))
+	}
+	for _, invalid := range []string{"", "not json", "null", "[]", "[{},{}]", `"dev"`} {
+		_, err := scrubHwinfo([]byte(invalid))
+		require.NotNil(t, err, invalid)
+	}
+}
+
+func TestBuiltinHwinfo(t *testing.T) {
+	root := setOSRoot(t)
+	write := func(path string, content string) {
+		require.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0o755))
+		require.Nil(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0o644))
+	}
+	write("proc/device-tree/model", "Raspberry Pi 4 Model B Rev 1.4\x00")
+	write("proc/cpuinfo", `processor	: 0
+BogoMIPS	: 108.00
+CPU implementer	: 0x41
+CPU part	: 0xd08
+
+processor	: 1
+BogoMIPS	: 108.00
+CPU implementer	: 0x41
+CPU part	: 0xd08
+`)
+	write("proc/meminfo", "MemTotal:        3881488 kB\nMemFree:          123456 kB\n")
+	write("sys/block/mmcblk0/size", "62333952\n")
+	write("sys/block/mmcblk0/removable", "0\n")
+	write("sys/block/mmcblk0/device/name", "SC32G\n")
+	write("sys/block/sda/size", "0\n")
+	write("sys/block/loop0/size", "1024\n")
+
+	info := builtinHwinfo()
+	b, err := json.Marshal(info)
+	require.Nil(t, err)
+	// The built-in info can be scrubbed the same way as the lshw output
+	_, err = scrubHwinfo(b)
+	require.Nil(t, err)
+
+	require.Equal(t, "system", info["class"])
+	require.Equal(t, "Raspberry Pi 4 Model B Rev 1.4", info["product"])
+	cores := hwinfoChildren(info)
+	require.Len(t, cores, 1)
+	require.Equal(t, "core", cores[0]["id"])
+
+	nodes := map[string]map[string]any{}
+	for _, child := range cores[0]["children"].([]any) {
+		node := child.(map[string]any)
+		nodes[node["id"].(string)] = node
+	}
+	require.Len(t, nodes, 3)
+	require.Equal(t, "ARM", nodes["cpu"]["vendor"])
+	require.Equal(t, "implementer 0x41 part 0xd08", nodes["cpu"]["product"])
+	require.Equal(t, map[string]any{"threads": "2"}, nodes["cpu"]["configuration"])
+	require.Equal(t, uint64(3881488*1024), nodes["memory"]["size"])
+	require.Equal(t, "/dev/mmcblk0", nodes["disk:0"]["logicalname"])
+	require.Equal(t, uint64(62333952*512), nodes["disk:0"]["size"])
+	require.Equal(t, "SC32G", nodes["disk:0"]["product"])
+}
+
+func TestBuiltinHwinfo_DMI(t *testing.T) {
+	root := setOSRoot(t)
+	write := func(path string, content string) {
+		require.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0o755))
+		require.Nil(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0o644))
+	}
+	write("sys/class/dmi/id/product_name", "NUC7i5BNH\n")
+	write("sys/class/dmi/id/sys_vendor", "Intel Corporation\n")
+	write("sys/class/dmi/id/board_name", "NUC7i5BNB\n")
+	write("sys/class/dmi/id/bios_vendor", "Intel Corp.\n")
+	write("sys/class/dmi/id/bios_version", "BNKBL357.86A.0062\n")
+	write("proc/cpuinfo", "processor\t: 0\nvendor_id\t: GenuineIntel\nmodel name\t: Intel(R) Core(TM) i5-7260U CPU @ 2.20GHz\n")
+
+	info := builtinHwinfo()
+	require.Equal(t, "NUC7i5BNH", info["product"])
+	require.Equal(t, "Intel Corporation", info["vendor"])
+	core := hwinfoChildren(info)[0]
+	require.Equal(t, "NUC7i5BNB", core["product"])
+	children := hwinfoChildren(core)
+	require.Len(t, children, 2)
+	require.Equal(t, "firmware", children[0]["id"])
+	require.Equal(t, "BNKBL357.86A.0062", children[0]["version"])
+	require.Equal(t, "Intel(R) Core(TM) i5-7260U CPU @ 2.20GHz", children[1]["product"])
+	require.Equal(t, "GenuineIntel", children[1]["vendor"])
+}
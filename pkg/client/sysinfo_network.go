@@ -4,32 +4,73 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 )
 
-type netInfo struct {
-	Host string `json:"hostname"`
-	Mac  string `json:"mac"`
-	Ip   string `json:"local_ipv4"`
-}
+const (
+	// Linux route flags, see include/uapi/linux/route.h
+	rtfUp     = 0x0001
+	rtfReject = 0x0200
+	// Flag of temporary (privacy extension) IPv6 addresses, see include/uapi/linux/if_addr.h
+	ifaFTemporary = 0x01
+	// ARP hardware types of network devices, see include/uapi/linux/if_arp.h
+	arphrdEther    = 1
+	arphrdLoopback = 772
+	arphrdNone     = 65534
 
-// UploadNetInfo uploads local ipv4 info to the gateway IFF its changed.
-func (c *GatewayClient) uploadNetInfo() error {
-	var err error
-	info := netInfo{}
-	info.Host, err = os.Hostname()
-	if err != nil {
-		return err
+	LinkTypeEthernet = "ethernet"
+	LinkTypeWifi     = "wifi"
+	LinkTypeCellular = "cellular"
+	LinkTypeBridge   = "bridge"
+	LinkTypeVlan     = "vlan"
+	LinkTypeTunnel   = "tunnel"
+	LinkTypeVirtual  = "virtual"
+	LinkTypeLoopback = "loopback"
+	LinkTypeOther    = "other"
+)
+
+type (
+	netInfo struct {
+		Host string `json:"hostname"`
+		// The MAC and the first IPv4 address of the primary interface, the one of the default route with
+		// the lowest metric; they are kept for compatibility with the backends that don't read the interfaces
+		Mac        string         `json:"mac"`
+		Ip         string         `json:"local_ipv4"`
+		Interfaces []netInterface `json:"interfaces"`
+	}
+
+	netInterface struct {
+		Name             string   `json:"name"`
+		Mac              string   `json:"mac,omitempty"`
+		Type             string   `json:"type"`
+		MTU              int      `json:"mtu"`
+		IPv4             []string `json:"ipv4,omitempty"`
+		IPv6             []string `json:"ipv6,omitempty"`
+		DefaultRouteIPv4 bool     `json:"default_route_ipv4,omitempty"`
+		DefaultRouteIPv6 bool     `json:"default_route_ipv6,omitempty"`
 	}
 
-	info.Ip, info.Mac, err = ipInfo()
+	// defaultRoutes maps the interface name to the lowest metric of its default route
+	defaultRoutes map[string]uint64
+)
+
+// UploadNetInfo uploads the info about network interfaces to the gateway IFF its changed,
+// e.g. after a failover from Ethernet to a cellular connection.
+func (c *GatewayClient) uploadNetInfo(ctx context.Context) error {
+	info, err := getNetInfo()
 	if err != nil {
 		return err
 	}
@@ -46,7 +87,7 @@ func (c *GatewayClient) uploadNetInfo() error {
 	}
 	slog.Debug("Net-info has change, uploading to server", "value", info)
 
-	res, err := c.Put("/system_info/network", info)
+	res, err := c.Put(ctx, "/system_info/network", info)
 	if err != nil {
 		return err
 	}
@@ -60,28 +101,227 @@ func (c *GatewayClient) uploadNetInfo() error {
 	return nil
 }
 
-func ipInfo() (string, string, error) {
-	netInfo, err := os.ReadFile("/proc/net/route")
+func getNetInfo() (*netInfo, error) {
+	var err error
+	info := netInfo{}
+	if info.Host, err = os.Hostname(); err != nil {
+		return nil, err
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list network interfaces: %w", err)
+	}
+	routesV4, err := readDefaultRoutesV4(filepath.Join(osRootDir, "proc/net/route"))
+	if err != nil {
+		slog.Debug("unable to read IPv4 routes", "error", err)
+	}
+	routesV6, err := readDefaultRoutesV6(filepath.Join(osRootDir, "proc/net/ipv6_route"))
+	if err != nil {
+		slog.Debug("unable to read IPv6 routes", "error", err)
+	}
+	temporary, err := readTemporaryIPv6Addrs(filepath.Join(osRootDir, "proc/net/if_inet6"))
+	if err != nil {
+		slog.Debug("unable to read IPv6 addresses", "error", err)
+	}
+
+	info.Interfaces = []netInterface{}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ni := netInterface{
+			Name: iface.Name,
+			Mac:  iface.HardwareAddr.String(),
+			Type: linkType(iface.Name),
+			MTU:  iface.MTU,
+		}
+		if isContainerInterface(ni.Name, ni.Type) {
+			continue
+		}
+		_, ni.DefaultRouteIPv4 = routesV4[iface.Name]
+		_, ni.DefaultRouteIPv6 = routesV6[iface.Name]
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("unable to lookup IP of interface(%s): %w", iface.Name, err)
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ipNet.IP.To4() != nil {
+				ni.IPv4 = append(ni.IPv4, addr.String())
+			} else if !temporary[ipNet.IP.String()] {
+				ni.IPv6 = append(ni.IPv6, addr.String())
+			}
+		}
+		// The addresses are kept in the kernel order, so the first IPv4 address is the primary one of the interface
+		info.Interfaces = append(info.Interfaces, ni)
+	}
+	slices.SortFunc(info.Interfaces, func(a, b netInterface) int { return strings.Compare(a.Name, b.Name) })
+
+	if primary := primaryInterface(info.Interfaces, routesV4, routesV6); primary != nil {
+		info.Mac = primary.Mac
+		if len(primary.IPv4) > 0 {
+			info.Ip = primary.IPv4[0]
+		}
+	}
+	return &info, nil
+}
+
+// primaryInterface returns the interface of the IPv4 default route with the lowest metric,
+// or the one of the IPv6 default route if there is no IPv4 default route, e.g. on IPv6-only networks
+func primaryInterface(ifaces []netInterface, routesV4, routesV6 defaultRoutes) *netInterface {
+	for _, routes := range []defaultRoutes{routesV4, routesV6} {
+		var primary *netInterface
+		var primaryMetric uint64 = math.MaxUint64
+		for i := range ifaces {
+			if metric, ok := routes[ifaces[i].Name]; ok && (primary == nil || metric < primaryMetric) {
+				primary = &ifaces[i]
+				primaryMetric = metric
+			}
+		}
+		if primary != nil {
+			return primary
+		}
+	}
+	return nil
+}
+
+// readDefaultRoutesV4 parses /proc/net/route:
+// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+func readDefaultRoutesV4(path string) (defaultRoutes, error) {
+	return readDefaultRoutes(path, func(fields []string) (string, uint64, bool) {
+		if len(fields) < 8 || fields[0] == "Iface" || fields[1] != "00000000" || fields[7] != "00000000" {
+			return "", 0, false
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil {
+			return "", 0, false
+		}
+		metric, _ := strconv.ParseUint(fields[6], 10, 64)
+		return fields[0], metric, flags&rtfUp != 0 && flags&rtfReject == 0
+	})
+}
+
+// readDefaultRoutesV6 parses /proc/net/ipv6_route:
+// Destination DestPrefixLen Source SourcePrefixLen NextHop Metric RefCnt Use Flags Iface
+func readDefaultRoutesV6(path string) (defaultRoutes, error) {
+	return readDefaultRoutes(path, func(fields []string) (string, uint64, bool) {
+		if len(fields) < 10 || fields[0] != strings.Repeat("0", 32) || fields[1] != "00" || fields[9] == "lo" {
+			return "", 0, false
+		}
+		flags, err := strconv.ParseUint(fields[8], 16, 32)
+		if err != nil {
+			return "", 0, false
+		}
+		metric, _ := strconv.ParseUint(fields[5], 16, 64)
+		return fields[9], metric, flags&rtfUp != 0 && flags&rtfReject == 0
+	})
+}
+
+func readDefaultRoutes(path string, parse func(fields []string) (string, uint64, bool)) (defaultRoutes, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return "", "", err
-	}
-
-	for i, line := range strings.Split(string(netInfo), "\n") {
-		if i > 0 {
-			parts := strings.Fields(line)
-			if len(parts) > 4 && parts[1] == "00000000" {
-				intf, err := net.InterfaceByName(parts[0])
-				if err != nil {
-					return "", "", fmt.Errorf("unable to lookup default interface(%s): %w", parts[0], err)
-				}
-				addrs, err := intf.Addrs()
-				if err != nil {
-					return "", "", fmt.Errorf("unable to lookup IP of interface(%s): %w", parts[0], err)
-				}
-				return addrs[0].String(), intf.HardwareAddr.String(), nil
+		return nil, err
+	}
+	defer f.Close()
+	routes := defaultRoutes{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if iface, metric, ok := parse(strings.Fields(scanner.Text())); ok {
+			if current, found := routes[iface]; !found || metric < current {
+				routes[iface] = metric
 			}
 		}
 	}
+	return routes, scanner.Err()
+}
+
+// readTemporaryIPv6Addrs returns the temporary IPv6 addresses found in /proc/net/if_inet6. These addresses
+// are regenerated periodically, so they are not reported to not upload the network info each time they change.
+// Address IfIndex PrefixLen Scope Flags Iface
+func readTemporaryIPv6Addrs(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	temporary := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[4], 16, 32)
+		if err != nil || flags&ifaFTemporary == 0 {
+			continue
+		}
+		if b, err := hex.DecodeString(fields[0]); err == nil && len(b) == net.IPv6len {
+			temporary[net.IP(b).String()] = true
+		}
+	}
+	return temporary, scanner.Err()
+}
+
+// isContainerInterface reports whether the interface is created by the container engine for the apps, i.e.
+// the veth end of a container or a Docker bridge. They come and go with the apps, so they are not reported.
+func isContainerInterface(name string, linkType string) bool {
+	switch linkType {
+	case LinkTypeVirtual:
+		return true
+	case LinkTypeBridge:
+		return name == "docker0" || strings.HasPrefix(name, "br-")
+	}
+	return false
+}
 
-	return "", "", errors.New("could not find default network interface")
+// linkType returns the type of the network link based on the device info found in sysfs
+func linkType(name string) string {
+	devDir := filepath.Join(osRootDir, "sys/class/net", name)
+	devType := ""
+	if uevent, err := os.ReadFile(filepath.Join(devDir, "uevent")); err == nil {
+		for _, line := range strings.Split(string(uevent), "\n") {
+			if value, ok := strings.CutPrefix(line, "DEVTYPE="); ok {
+				devType = strings.TrimSpace(value)
+			}
+		}
+	}
+	switch devType {
+	case "wlan":
+		return LinkTypeWifi
+	case "wwan":
+		return LinkTypeCellular
+	case "bridge":
+		return LinkTypeBridge
+	case "vlan":
+		return LinkTypeVlan
+	}
+	if _, err := os.Stat(filepath.Join(devDir, "wireless")); err == nil {
+		return LinkTypeWifi
+	}
+	if _, err := os.Stat(filepath.Join(devDir, "bridge")); err == nil {
+		return LinkTypeBridge
+	}
+	_, errDevice := os.Stat(filepath.Join(devDir, "device"))
+	hwType := -1
+	if b, err := os.ReadFile(filepath.Join(devDir, "type")); err == nil {
+		hwType, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+	}
+	switch {
+	case hwType == arphrdLoopback:
+		return LinkTypeLoopback
+	case hwType == arphrdEther && errDevice == nil:
+		return LinkTypeEthernet
+	case hwType == arphrdEther:
+		// veth, dummy and other software devices have no backing device
+		return LinkTypeVirtual
+	case hwType == arphrdNone && errDevice == nil:
+		// raw IP devices of cellular modems
+		return LinkTypeCellular
+	case hwType == arphrdNone, devType == "tun", devType == "wireguard":
+		return LinkTypeTunnel
+	}
+	return LinkTypeOther
 }
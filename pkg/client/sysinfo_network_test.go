@@ -4,6 +4,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -12,19 +13,18 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func Test_ipInfo(t *testing.T) {
-	// we can't really test/validate ipinfo well, so:
+func Test_getNetInfo(t *testing.T) {
+	// we can't really test/validate netinfo well, so:
 	//  * make sure it doesn't fail
 	//  * make sure we don't try to report if it hasn't changed
-	var err error
-	info := netInfo{}
-	info.Host, err = os.Hostname()
-	require.Nil(t, err)
-	info.Ip, info.Mac, err = ipInfo()
+	info, err := getNetInfo()
 	require.Nil(t, err)
 	// We can't really test these values so just dump them
 	t.Logf("Local IPv4: %s", info.Ip)
 	t.Logf("Mac addr: %s", info.Mac)
+	for _, iface := range info.Interfaces {
+		t.Logf("Interface: %+v", iface)
+	}
 
 	// Now cache this info
 	infoBytes, err := json.Marshal(info)
@@ -38,5 +38,86 @@ func Test_ipInfo(t *testing.T) {
 	// If our caching logic doesn't work - this will crash with a nil pointer
 	// trying to talk to the device-gateway
 	require.Nil(t, os.WriteFile(gw.lastNetInfoFile, infoBytes, 0o740))
-	require.Nil(t, gw.uploadNetInfo())
+	require.Nil(t, gw.uploadNetInfo(context.Background()))
+}
+
+func Test_readDefaultRoutes(t *testing.T) {
+	dir := t.TempDir()
+	routeV4 := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0101A8C0	0003	0	0	100	00000000	0	0	0
+wwan0	00000000	01000A0A	0003	0	0	700	00000000	0	0	0
+eth0	0001A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+wlan0	00000000	00000000	0201	0	0	50	00000000	0	0	0
+`
+	routeV6 := `00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00450003     eth1
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth1
+`
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "route"), []byte(routeV4), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "ipv6_route"), []byte(routeV6), 0o644))
+
+	routesV4, err := readDefaultRoutesV4(filepath.Join(dir, "route"))
+	require.Nil(t, err)
+	// The reject route of wlan0 is not a default route
+	require.Equal(t, defaultRoutes{"eth0": 100, "wwan0": 700}, routesV4)
+
+	routesV6, err := readDefaultRoutesV6(filepath.Join(dir, "ipv6_route"))
+	require.Nil(t, err)
+	require.Equal(t, defaultRoutes{"eth1": 0x400}, routesV6)
+
+	ifaces := []netInterface{{Name: "eth0"}, {Name: "eth1"}, {Name: "wwan0"}}
+	require.Equal(t, "eth0", primaryInterface(ifaces, routesV4, routesV6).Name)
+	// Failover to the cellular connection
+	delete(routesV4, "eth0")
+	require.Equal(t, "wwan0", primaryInterface(ifaces, routesV4, routesV6).Name)
+	// IPv6-only network
+	require.Equal(t, "eth1", primaryInterface(ifaces, nil, routesV6).Name)
+	require.Nil(t, primaryInterface(ifaces, nil, nil))
+}
+
+func Test_readTemporaryIPv6Addrs(t *testing.T) {
+	ifInet6 := `fe80000000000000020c29fffe3a4b5c 02 40 20 80     eth0
+20010db8000000000000000000000001 02 40 00 80     eth0
+20010db800000000a1b2c3d4e5f60718 02 40 00 01     eth0
+`
+	path := filepath.Join(t.TempDir(), "if_inet6")
+	require.Nil(t, os.WriteFile(path, []byte(ifInet6), 0o644))
+	temporary, err := readTemporaryIPv6Addrs(path)
+	require.Nil(t, err)
+	require.Equal(t, map[string]bool{"2001:db8::a1b2:c3d4:e5f6:718": true}, temporary)
+}
+
+func Test_linkType(t *testing.T) {
+	root := setOSRoot(t)
+	netDir := filepath.Join(root, "sys/class/net")
+	addLink := func(name string, hwType string, uevent string, subdirs ...string) {
+		require.Nil(t, os.MkdirAll(filepath.Join(netDir, name), 0o755))
+		require.Nil(t, os.WriteFile(filepath.Join(netDir, name, "type"), []byte(hwType+"\n"), 0o644))
+		require.Nil(t, os.WriteFile(filepath.Join(netDir, name, "uevent"), []byte(uevent), 0o644))
+		for _, d := range subdirs {
+			require.Nil(t, os.MkdirAll(filepath.Join(netDir, name, d), 0o755))
+		}
+	}
+	addLink("eth0", "1", "INTERFACE=eth0\nIFINDEX=2\n", "device")
+	addLink("wlan0", "1", "DEVTYPE=wlan\nINTERFACE=wlan0\n", "device")
+	addLink("wwan0", "65534", "INTERFACE=wwan0\n", "device")
+	addLink("br0", "1", "DEVTYPE=bridge\nINTERFACE=br0\n")
+	addLink("veth1", "1", "INTERFACE=veth1\n")
+	addLink("wg0", "65534", "DEVTYPE=wireguard\nINTERFACE=wg0\n")
+
+	require.Equal(t, LinkTypeEthernet, linkType("eth0"))
+	require.Equal(t, LinkTypeWifi, linkType("wlan0"))
+	require.Equal(t, LinkTypeCellular, linkType("wwan0"))
+	require.Equal(t, LinkTypeBridge, linkType("br0"))
+	require.Equal(t, LinkTypeVirtual, linkType("veth1"))
+	require.Equal(t, LinkTypeTunnel, linkType("wg0"))
+	require.Equal(t, LinkTypeOther, linkType("unknown0"))
+
+	addLink("docker0", "1", "DEVTYPE=bridge\nINTERFACE=docker0\n")
+	addLink("br-3f2a9c1d7e6b", "1", "DEVTYPE=bridge\nINTERFACE=br-3f2a9c1d7e6b\n")
+	for name, container := range map[string]bool{
+		"eth0": false, "br0": false, "veth1": true, "docker0": true, "br-3f2a9c1d7e6b": true,
+	} {
+		require.Equal(t, container, isContainerInterface(name, linkType(name)), name)
+	}
 }
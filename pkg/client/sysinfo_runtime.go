@@ -0,0 +1,225 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/foundriesio/composeapp/pkg/compose"
+)
+
+const (
+	sysInfoDockerTimeout    = 10 * time.Second
+	sysInfoCollectorTimeout = 10 * time.Second
+)
+
+type (
+	storageInfo struct {
+		Path      string `json:"path"`
+		UsedBytes int64  `json:"used_bytes"`
+		FsBytes   uint64 `json:"fs_bytes"`
+		FsFree    uint64 `json:"fs_free_bytes"`
+	}
+
+	dockerInfo struct {
+		Version       string `json:"version"`
+		StorageDriver string `json:"storage_driver"`
+		CgroupDriver  string `json:"cgroup_driver,omitempty"`
+		CgroupVersion string `json:"cgroup_version,omitempty"`
+	}
+
+	containerRuntimeInfo struct {
+		Default          string   `json:"default"`
+		Runtimes         []string `json:"runtimes"`
+		ContainerdCommit string   `json:"containerd_commit,omitempty"`
+		RuncCommit       string   `json:"runc_commit,omitempty"`
+	}
+
+	kernelInfo struct {
+		Name    string `json:"name"`
+		Release string `json:"release"`
+		Version string `json:"version"`
+		Arch    string `json:"arch"`
+	}
+
+	uptimeInfo struct {
+		BootTime time.Time `json:"boot_time"`
+		Seconds  int64     `json:"seconds"`
+	}
+)
+
+// getRuntimeSysInfo returns the enabled system information components that are reported
+// along with the hardware information
+func getRuntimeSysInfo(components map[string]bool, cfg *compose.Config, collectorsDir string) map[string]any {
+	info := map[string]any{}
+	add := func(name string, collect func() (any, error)) {
+		if !components[name] {
+			return
+		}
+		if value, err := collect(); err == nil {
+			info[name] = value
+		} else {
+			slog.Debug("failed to collect system information", "component", name, "error", err)
+		}
+	}
+	add(SysInfoStorage, func() (any, error) { return getStorageInfo(cfg.StoreRoot) })
+	if components[SysInfoDocker] || components[SysInfoContainerRuntime] {
+		docker, runtimes, err := getDockerInfo(cfg.DockerHost)
+		add(SysInfoDocker, func() (any, error) { return docker, err })
+		add(SysInfoContainerRuntime, func() (any, error) { return runtimes, err })
+	}
+	add(SysInfoKernel, func() (any, error) { return getKernelInfo() })
+	add(SysInfoUptime, func() (any, error) { return getUptimeInfo() })
+	if components[SysInfoCollectors] {
+		if collected, err := runSysInfoCollectors(collectorsDir); err != nil {
+			slog.Debug("failed to run system information collectors", "dir", collectorsDir, "error", err)
+		} else if len(collected) > 0 {
+			info[SysInfoCollectors] = collected
+		}
+	}
+	return info
+}
+
+func getStorageInfo(storeRoot string) (*storageInfo, error) {
+	info := &storageInfo{Path: storeRoot}
+	err := filepath.WalkDir(storeRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				info.UsedBytes += fi.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fsStat, err := compose.GetFsStat(storeRoot)
+	if err != nil {
+		return nil, err
+	}
+	info.FsBytes = uint64(fsStat.BlockSize) * fsStat.Blocks
+	info.FsFree = uint64(fsStat.BlockSize) * fsStat.Bfree
+	return info, nil
+}
+
+func getDockerInfo(dockerHost string) (*dockerInfo, *containerRuntimeInfo, error) {
+	cli, err := compose.GetDockerClient(dockerHost)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cli.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), sysInfoDockerTimeout)
+	defer cancel()
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &dockerInfo{
+		Version:       info.ServerVersion,
+		StorageDriver: info.Driver,
+		CgroupDriver:  info.CgroupDriver,
+		CgroupVersion: info.CgroupVersion,
+	}, &containerRuntimeInfo{
+		Default:          info.DefaultRuntime,
+		Runtimes:         slices.Sorted(maps.Keys(info.Runtimes)),
+		ContainerdCommit: info.ContainerdCommit.ID,
+		RuncCommit:       info.RuncCommit.ID,
+	}, nil
+}
+
+func getKernelInfo() (*kernelInfo, error) {
+	info := &kernelInfo{Arch: runtime.GOARCH}
+	for _, f := range []struct {
+		file  string
+		value *string
+	}{
+		{"ostype", &info.Name},
+		{"osrelease", &info.Release},
+		{"version", &info.Version},
+	} {
+		b, err := os.ReadFile(filepath.Join(osRootDir, "proc/sys/kernel", f.file))
+		if err != nil {
+			return nil, err
+		}
+		*f.value = strings.TrimSpace(string(b))
+	}
+	return info, nil
+}
+
+func getUptimeInfo() (*uptimeInfo, error) {
+	b, err := os.ReadFile(filepath.Join(osRootDir, "proc/uptime"))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return nil, errors.New("empty /proc/uptime")
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid /proc/uptime: %w", err)
+	}
+	seconds := int64(uptime)
+	return &uptimeInfo{
+		BootTime: time.Now().Add(-time.Duration(seconds) * time.Second).UTC().Truncate(time.Minute),
+		Seconds:  seconds,
+	}, nil
+}
+
+// runSysInfoCollectors runs the executables found in the given directory, each of them must print a JSON document.
+// The documents are returned by the names of the executables, the output of failed executables is ignored.
+func runSysInfoCollectors(dir string) (map[string]json.RawMessage, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	collected := map[string]json.RawMessage{}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		output, err := runSysInfoCollector(path)
+		if err != nil {
+			slog.Warn("system information collector failed", "collector", path, "error", err)
+			continue
+		}
+		collected[strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))] = output
+	}
+	return collected, nil
+}
+
+func runSysInfoCollector(path string) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sysInfoCollectorTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path).Output()
+	if err != nil {
+		return nil, err
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, output); err != nil {
+		return nil, fmt.Errorf("output is not a valid JSON: %w", err)
+	}
+	return compacted.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/foundriesio/fioup/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func newSysInfoTestConfig(t *testing.T, pacman string) *config.Config {
+	t.Helper()
+	tmpdir := t.TempDir()
+	sota := fmt.Sprintf(`
+[tls]
+server = "https://example.com:8443"
+
+[storage]
+path = "%s"
+
+[pacman]
+reset_apps_root = "%s"
+compose_apps_root = "%s"
+%s
+`, tmpdir, tmpdir, tmpdir, pacman)
+	require.Nil(t, os.WriteFile(filepath.Join(tmpdir, "sota.toml"), []byte(sota), 0o644))
+	cfg, err := config.NewConfig([]string{tmpdir})
+	require.Nil(t, err)
+	return cfg
+}
+
+func TestGetSysInfoComponents(t *testing.T) {
+	components := getSysInfoComponents(newSysInfoTestConfig(t, ""))
+	require.Len(t, components, len(sysInfoComponents))
+
+	components = getSysInfoComponents(newSysInfoTestConfig(t, `sysinfo_disabled = "hwinfo, docker,unknown"`))
+	require.Len(t, components, len(sysInfoComponents)-2)
+	require.False(t, components[SysInfoHwinfo])
+	require.False(t, components[SysInfoDocker])
+	require.True(t, components[SysInfoNetwork])
+
+	require.Empty(t, getSysInfoComponents(newSysInfoTestConfig(t, `sysinfo = "0"`)))
+}
+
+func TestRunSysInfoCollectors(t *testing.T) {
+	dir := t.TempDir()
+	collected, err := runSysInfoCollectors(filepath.Join(dir, "does-not-exist"))
+	require.Nil(t, err)
+	require.Empty(t, collected)
+
+	scripts := map[string]string{
+		"battery.sh": "#!/bin/sh\necho '{\"level\": 87,\n \"charging\": false}'\n",
+		"invalid":    "#!/bin/sh\necho 'not json'\n",
+		"failed":     "#!/bin/sh\necho '{}'\nexit 1\n",
+	}
+	for name, content := range scripts {
+		require.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o755))
+	}
+	// Not executable files are ignored
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "README"), []byte("{}"), 0o644))
+
+	collected, err = runSysInfoCollectors(dir)
+	require.Nil(t, err)
+	require.Len(t, collected, 1)
+	require.JSONEq(t, `{"level":87,"charging":false}`, string(collected["battery"]))
+	b, err := json.Marshal(collected)
+	require.Nil(t, err)
+	require.Equal(t, `{"battery":{"level":87,"charging":false}}`, string(b))
+}
+
+func TestGetKernelAndUptimeInfo(t *testing.T) {
+	root := setOSRoot(t)
+	kernelDir := filepath.Join(root, "proc/sys/kernel")
+	require.Nil(t, os.MkdirAll(kernelDir, 0o755))
+	require.Nil(t, os.WriteFile(filepath.Join(kernelDir, "ostype"), []byte("Linux\n"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(kernelDir, "osrelease"), []byte("6.6.52-lmp-standard\n"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(kernelDir, "version"), []byte("#1 SMP PREEMPT\n"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(root, "proc/uptime"), []byte("7260.53 14000.10\n"), 0o644))
+
+	kernel, err := getKernelInfo()
+	require.Nil(t, err)
+	require.Equal(t, "Linux", kernel.Name)
+	require.Equal(t, "6.6.52-lmp-standard", kernel.Release)
+	require.Equal(t, "#1 SMP PREEMPT", kernel.Version)
+
+	uptime, err := getUptimeInfo()
+	require.Nil(t, err)
+	require.Equal(t, int64(7260), uptime.Seconds)
+	require.WithinDuration(t, time.Now().Add(-7260*time.Second), uptime.BootTime, 2*time.Minute)
+}
+
+func TestGatewayClient_initHwinfoIgnoresVolatileValues(t *testing.T) {
+	root := setOSRoot(t)
+	kernelDir := filepath.Join(root, "proc/sys/kernel")
+	require.Nil(t, os.MkdirAll(kernelDir, 0o755))
+	writeKernel := func(release string) {
+		require.Nil(t, os.WriteFile(filepath.Join(kernelDir, "ostype"), []byte("Linux\n"), 0o644))
+		require.Nil(t, os.WriteFile(filepath.Join(kernelDir, "osrelease"), []byte(release+"\n"), 0o644))
+		require.Nil(t, os.WriteFile(filepath.Join(kernelDir, "version"), []byte("#1 SMP PREEMPT\n"), 0o644))
+	}
+	writeKernel("6.6.52-lmp-standard")
+	require.Nil(t, os.WriteFile(filepath.Join(root, "proc/uptime"), []byte("7260.53 14000.10\n"), 0o644))
+
+	cfg := newSysInfoTestConfig(t, "")
+	gw := GatewayClient{
+		osIdentity:        OSIdentity{Hash: unknownOSIdentityHash, Source: OSIdentitySourceUnknown},
+		sysInfoComponents: map[string]bool{SysInfoKernel: true, SysInfoUptime: true, SysInfoStorage: true},
+		lastHwinfoFile:    filepath.Join(t.TempDir(), ".last-hwinfo"),
+	}
+	gw.initHwinfo(cfg)
+	require.NotNil(t, gw.hwinfoToReport)
+	var reported map[string]any
+	require.Nil(t, json.Unmarshal(gw.hwinfoToReport, &reported))
+	require.Contains(t, reported, SysInfoUptime)
+	require.Contains(t, reported[SysInfoStorage], "used_bytes")
+	require.Nil(t, os.WriteFile(gw.lastHwinfoFile, gw.hwinfoToSave, 0o644))
+
+	// The uptime and the used storage change on each collection, they do not make the info uploaded
+	require.Nil(t, os.WriteFile(filepath.Join(root, "proc/uptime"), []byte("9999.12 14000.10\n"), 0o644))
+	require.Nil(t, os.WriteFile(filepath.Join(cfg.ComposeConfig().StoreRoot, "blob"), []byte("data"), 0o644))
+	gw.initHwinfo(cfg)
+	require.Nil(t, gw.hwinfoToReport)
+
+	writeKernel("6.6.60-lmp-standard")
+	gw.initHwinfo(cfg)
+	require.NotNil(t, gw.hwinfoToReport)
+	require.Contains(t, string(gw.hwinfoToReport), `"seconds":9999`)
+}
@@ -5,20 +5,37 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/foundriesio/fioconfig/sotatoml"
+	"github.com/pelletier/go-toml"
+)
+
+const redactedValue = "REDACTED"
+
+var (
+	// Words of config key names that denote secrets, e.g. `p11.pass` holding the PKCS#11 PIN or `api_token`
+	redactedKeyWords = []string{
+		"pass", "passwd", "password", "passphrase", "pin", "secret", "token", "apikey", "credential", "credentials",
+	}
+	keyWordSeparators = regexp.MustCompile(`[^a-z0-9]+`)
 )
 
 // uploadSotaToml uploads the *combined* sota TOML configuration IFF its changed.
-func (c *GatewayClient) uploadSotaToml() error {
+func (c *GatewayClient) uploadSotaToml(ctx context.Context) error {
 	if c.sotaToReport == nil {
 		slog.Debug("Sota TOML has not changed")
 		return nil
 	}
-	res, err := c.Put("/system_info/config", c.sotaToReport)
+	res, err := c.Put(ctx, "/system_info/config", c.sotaToReport)
 	if err != nil {
 		return err
 	}
@@ -36,12 +53,18 @@ func (c *GatewayClient) uploadSotaToml() error {
 	return nil
 }
 
-func (c *GatewayClient) initSota(config *sotatoml.AppConfig) {
-	tree, err := config.CombinedConfig()
+func (c *GatewayClient) initSota(config *sotatoml.AppConfig, redactPatterns []string) {
+	combined, err := config.CombinedConfig()
 	if err != nil {
 		slog.Error("Unable to parse TOML files. Will not publish to server", "error", err)
 		return
 	}
+	// Secrets are redacted before the comparison too, so they are never stored in the last reported file
+	tree, err := toml.TreeFromMap(redactConfig(combined.ToMap(), "", redactPatterns))
+	if err != nil {
+		slog.Error("Unable to redact TOML files. Will not publish to server", "error", err)
+		return
+	}
 
 	current, err := tree.Marshal()
 	if err != nil {
@@ -55,3 +78,72 @@ func (c *GatewayClient) initSota(config *sotatoml.AppConfig) {
 	}
 	c.sotaToReport = current // Lets UploadSotaToml know to publish
 }
+
+// redactConfig replaces the values of config keys that may hold secrets with a placeholder. A key is redacted if
+// its name contains one of the secret words, if its dotted path or name matches one of the given patterns, or if
+// its value is inline key material. Passwords in URLs, e.g. of a proxy, are redacted too.
+func redactConfig(config map[string]any, prefix string, patterns []string) map[string]any {
+	for key, value := range config {
+		keyPath := key
+		if len(prefix) > 0 {
+			keyPath = prefix + "." + key
+		}
+		if isRedactedKey(key, keyPath, patterns) {
+			config[key] = redactedValue
+			continue
+		}
+		config[key] = redactConfigValue(value, keyPath, patterns)
+	}
+	return config
+}
+
+func redactConfigValue(value any, keyPath string, patterns []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return redactConfig(v, keyPath, patterns)
+	case []map[string]any:
+		for i := range v {
+			v[i] = redactConfig(v[i], keyPath, patterns)
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactConfigValue(v[i], keyPath, patterns)
+		}
+	case string:
+		return redactString(v)
+	}
+	return value
+}
+
+func isRedactedKey(key string, keyPath string, patterns []string) bool {
+	for _, word := range keyWordSeparators.Split(strings.ToLower(key), -1) {
+		if slices.Contains(redactedKeyWords, word) {
+			return true
+		}
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, keyPath); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func redactString(value string) string {
+	if strings.Contains(value, "-----BEGIN ") {
+		// Inline PEM encoded key or certificate
+		return redactedValue
+	}
+	if strings.Contains(value, "@") && strings.Contains(value, "://") {
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				u.User = url.UserPassword(u.User.Username(), redactedValue)
+				return u.String()
+			}
+		}
+	}
+	return value
+}
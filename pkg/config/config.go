@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/foundriesio/composeapp/pkg/compose"
 	v1 "github.com/foundriesio/composeapp/pkg/compose/v1"
@@ -50,6 +51,27 @@ const (
 	ComposeAppsProxyKey             = "pacman.compose_apps_proxy"
 	ComposeAppsProxyCaKey           = "import.tls_cacert_path"
 	ComposeAppsPruneUnusedImagesKey = "pacman.prune_unused_images"
+	EventsMaxCountKey               = "pacman.events_max_count"    // max number of events kept in the local queue
+	EventsMaxAgeKey                 = "pacman.events_max_age_days" // max age of events kept in the local queue
+	EventsMaxAttemptsKey            = "pacman.events_max_attempts" // max number of rejected delivery attempts per event
+	EventsFileKey                   = "pacman.events_file"         // path to a JSONL file to append events to
+	EventsWebhookURLKey             = "pacman.events_webhook_url"  // URL to post events to
+	EventsMQTTBrokerKey             = "pacman.events_mqtt_broker"  // address of a local MQTT broker to publish events to
+	EventsMQTTTopicKey              = "pacman.events_mqtt_topic"
+	TargetsKeysFileKey              = "pacman.targets_keys_file"    // pinned TUF root metadata to verify targets.json with
+	TargetsHistorySizeKey           = "pacman.targets_history_size" // number of previous targets.json versions kept
+	AppLogsLinesKey                 = "pacman.app_logs_lines"       // number of log lines reported for unhealthy services
+	AppLogsMaxSizeKey               = "pacman.app_logs_max_size"    // max size in bytes of logs reported per service, 0 - no limit
+	AppStatesPollIntervalKey        = "pacman.app_states_poll_seconds"
+	AppStatesWatchEventsKey         = "pacman.app_states_watch_events" // report app states on docker container events
+	OSIdentityCommandKey            = "pacman.os_identity_command"     // command printing the identity of the running OS
+	SysInfoKey                      = "pacman.sysinfo"                 // report system information to the Device Gateway
+	SysInfoDisabledKey              = "pacman.sysinfo_disabled"        // comma separated list of system information components not reported
+	SysInfoCollectorsDirKey         = "pacman.sysinfo_collectors_dir"  // directory with scripts printing extra system information
+	SysInfoRedactKey                = "pacman.sysinfo_redact"          // comma separated patterns of config keys not uploaded
+	GatewayTimeoutKey               = "pacman.gateway_timeout_seconds" // timeout of connecting to the Device Gateway and of waiting for its response data
+	GatewayMaxRetriesKey            = "pacman.gateway_max_retries"     // max number of retries of a failed request to the Device Gateway
+	GatewayAlternateURLsKey         = "pacman.gateway_alternate_urls"  // comma separated list of Device Gateway URLs to fail over to
 
 	StorageDefaultDir               = "/var/sota"
 	StorageDefaultDBPath            = "sql.db"
@@ -59,6 +81,17 @@ const (
 	StorageUsageWatermarkDefault    = 95
 	MinStorageUsageWatermark        = 20
 	MaxStorageUsageWatermark        = 99
+	EventsMaxCountDefault           = 1000
+	EventsMaxAgeDefault             = 30
+	EventsMaxAttemptsDefault        = 10
+	EventsMQTTTopicDefault          = "fioup/events"
+	TargetsHistorySizeDefault       = 3
+	AppLogsLinesDefault             = 50
+	AppLogsMaxSizeDefault           = 4096
+	AppStatesPollIntervalDefault    = 60
+	SysInfoCollectorsDirDefault     = "/etc/fioup/sysinfo.d"
+	GatewayTimeoutDefault           = 30
+	GatewayMaxRetriesDefault        = 5
 )
 
 func NewConfig(tomlConfigPaths []string) (*Config, error) {
@@ -152,6 +185,17 @@ func (c *Config) GetTag() string {
 	return c.tomlConfig.Get(TagKey)
 }
 
+// GetTags returns the list of tags set as a comma separated value of the tag setting
+func (c *Config) GetTags() []string {
+	var tags []string
+	for _, tag := range strings.Split(c.GetTag(), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 func (c *Config) GetServerBaseURL() *url.URL {
 	return c.dgBaseURL
 }
@@ -199,6 +243,152 @@ func (c *Config) GetImagePruningFlag() bool {
 	return c.tomlConfig.GetDefault(ComposeAppsPruneUnusedImagesKey, "0") == "1"
 }
 
+// GetEventsMaxCount returns the maximum number of events kept in the local queue; 0 means no limit
+func (c *Config) GetEventsMaxCount() int {
+	return c.getNonNegativeInt(EventsMaxCountKey, EventsMaxCountDefault)
+}
+
+// GetEventsMaxAge returns the maximum age of events kept in the local queue; 0 means no limit
+func (c *Config) GetEventsMaxAge() time.Duration {
+	return time.Duration(c.getNonNegativeInt(EventsMaxAgeKey, EventsMaxAgeDefault)) * 24 * time.Hour
+}
+
+// GetEventsMaxAttempts returns the number of rejected delivery attempts after which an event is moved aside;
+// 0 means an event is retried until it is delivered or pruned
+func (c *Config) GetEventsMaxAttempts() int {
+	return c.getNonNegativeInt(EventsMaxAttemptsKey, EventsMaxAttemptsDefault)
+}
+
+// GetEventsFile returns the path of the file events are appended to; empty if the file sink is disabled
+func (c *Config) GetEventsFile() string {
+	return c.tomlConfig.GetDefault(EventsFileKey, "")
+}
+
+// GetEventsWebhookURL returns the URL events are posted to; empty if the webhook sink is disabled
+func (c *Config) GetEventsWebhookURL() string {
+	return c.tomlConfig.GetDefault(EventsWebhookURLKey, "")
+}
+
+// GetEventsMQTTBroker returns the MQTT broker address events are published to; empty if the MQTT sink is disabled
+func (c *Config) GetEventsMQTTBroker() string {
+	return c.tomlConfig.GetDefault(EventsMQTTBrokerKey, "")
+}
+
+func (c *Config) GetEventsMQTTTopic() string {
+	return c.tomlConfig.GetDefault(EventsMQTTTopicKey, EventsMQTTTopicDefault)
+}
+
+// GetTargetsKeysFile returns the path of the pinned TUF root metadata whose targets role keys are used
+// to verify targets.json fetched in the plain (non-TUF) mode; empty if the verification is disabled
+func (c *Config) GetTargetsKeysFile() string {
+	return c.tomlConfig.GetDefault(TargetsKeysFileKey, "")
+}
+
+// GetTargetsHistorySize returns the number of previous versions of targets.json kept on the local storage
+func (c *Config) GetTargetsHistorySize() int {
+	return c.getNonNegativeInt(TargetsHistorySizeKey, TargetsHistorySizeDefault)
+}
+
+// GetAppLogsLines returns the number of the last container log lines reported for unhealthy or exited services;
+// 0 means no logs are reported
+func (c *Config) GetAppLogsLines() int {
+	return c.getNonNegativeInt(AppLogsLinesKey, AppLogsLinesDefault)
+}
+
+// GetAppLogsMaxSize returns the maximum size in bytes of the logs reported per service;
+// 0 means the size of the logs is not limited, only the number of lines is
+func (c *Config) GetAppLogsMaxSize() int {
+	return c.getNonNegativeInt(AppLogsMaxSizeKey, AppLogsMaxSizeDefault)
+}
+
+// GetAppStatesPollInterval returns the interval of checking the app states for changes in daemon mode;
+// 0 means the states are not polled
+func (c *Config) GetAppStatesPollInterval() time.Duration {
+	return time.Duration(c.getNonNegativeInt(AppStatesPollIntervalKey, AppStatesPollIntervalDefault)) * time.Second
+}
+
+// GetAppStatesWatchEvents returns true if the app states are checked for changes on docker container events in daemon mode
+func (c *Config) GetAppStatesWatchEvents() bool {
+	return c.tomlConfig.GetDefault(AppStatesWatchEventsKey, "1") == "1"
+}
+
+// GetOSIdentityCommand returns the command whose output identifies the running OS build;
+// empty if the identity is detected from ostree or os-release
+func (c *Config) GetOSIdentityCommand() string {
+	return c.tomlConfig.GetDefault(OSIdentityCommandKey, "")
+}
+
+// GetSysInfoEnabled returns true if the system information is reported to the Device Gateway
+func (c *Config) GetSysInfoEnabled() bool {
+	return c.tomlConfig.GetDefault(SysInfoKey, "1") == "1"
+}
+
+// GetSysInfoDisabledComponents returns the names of system information components that are not reported
+func (c *Config) GetSysInfoDisabledComponents() []string {
+	return c.getList(SysInfoDisabledKey)
+}
+
+// GetSysInfoRedactPatterns returns the patterns of config keys whose values are redacted before the config is
+// uploaded to the Device Gateway, in addition to the keys that are known to hold secrets
+func (c *Config) GetSysInfoRedactPatterns() []string {
+	return c.getList(SysInfoRedactKey)
+}
+
+// GetSysInfoCollectorsDir returns the directory with executables whose JSON output is reported as
+// a part of the system information
+func (c *Config) GetSysInfoCollectorsDir() string {
+	return c.tomlConfig.GetDefault(SysInfoCollectorsDirKey, SysInfoCollectorsDirDefault)
+}
+
+// GetGatewayTimeout returns the timeout of connecting to the Device Gateway, of receiving the response headers,
+// and of each wait for the response body data; 0 means no timeout
+func (c *Config) GetGatewayTimeout() time.Duration {
+	return time.Duration(c.getNonNegativeInt(GatewayTimeoutKey, GatewayTimeoutDefault)) * time.Second
+}
+
+// GetGatewayMaxRetries returns the maximum number of retries of a request to the Device Gateway that failed transiently
+func (c *Config) GetGatewayMaxRetries() int {
+	return c.getNonNegativeInt(GatewayMaxRetriesKey, GatewayMaxRetriesDefault)
+}
+
+// GetGatewayAlternateURLs returns the Device Gateway URLs to send requests to when the server URL is unavailable
+func (c *Config) GetGatewayAlternateURLs() []*url.URL {
+	var urls []*url.URL
+	for _, item := range c.getList(GatewayAlternateURLsKey) {
+		u, err := url.Parse(item)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			slog.Warn("ignoring invalid alternate Device Gateway URL", "url", item, "error", err)
+			continue
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// getList returns the non-empty items of a comma separated value
+func (c *Config) getList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(c.tomlConfig.GetDefault(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (c *Config) getNonNegativeInt(key string, defaultValue int) int {
+	if !c.tomlConfig.Has(key) {
+		return defaultValue
+	}
+	valueStr := c.tomlConfig.Get(key)
+	value, err := strconv.Atoi(valueStr)
+	if err != nil || value < 0 {
+		slog.Warn("invalid value in config; using default", "key", key, "value", valueStr, "default", defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
 func newComposeConfig(config *sotatoml.AppConfig, proxyProvider compose.ProxyProvider) (*compose.Config, error) {
 	// TODO: set the defaults in cmd/fioup package instead of here
 	return v1.NewDefaultConfig(
@@ -17,6 +17,7 @@ import (
 	"github.com/foundriesio/composeapp/pkg/compose"
 	"github.com/foundriesio/composeapp/pkg/update"
 	"github.com/foundriesio/fioup/internal/events"
+	"github.com/foundriesio/fioup/internal/targets"
 	"github.com/foundriesio/fioup/pkg/status"
 	"github.com/foundriesio/fioup/pkg/target"
 	"github.com/oklog/ulid/v2"
@@ -78,12 +79,7 @@ func (s *Check) Execute(ctx context.Context, updateCtx *UpdateContext) error {
 		}
 	}
 
-	var targetRepo target.Repo
-	if s.EnableTUF {
-		targetRepo, err = target.NewTufRepo(updateCtx.Config, updateCtx.Client, updateCtx.Config.GetHardwareID())
-	} else {
-		targetRepo, err = target.NewPlainRepo(updateCtx.Client, updateCtx.Config.GetTargetsFilepath(), updateCtx.Config.GetHardwareID())
-	}
+	targetRepo, err := target.NewRepo(updateCtx.Config, updateCtx.Client, s.EnableTUF)
 	if err != nil {
 		return fmt.Errorf("%w: %w", ErrMetaUpdateFailed, err)
 	}
@@ -94,17 +90,17 @@ func (s *Check) Execute(ctx context.Context, updateCtx *UpdateContext) error {
 
 	defer func() {
 		if err != nil || (newTargetsVersion != -1 && newTargetsVersion != currentTargetsVersion) {
-			updateCtx.sendMetadataUpdateCompletedEvent(currentTargetsVersion, newTargetsVersion, err)
+			updateCtx.sendMetadataUpdateCompletedEvent(currentTargetsVersion, newTargetsVersion, targetRepo.MetadataVersions(), targetRepo.BytesSaved(), err)
 		}
 	}()
 
 	// Load current targets
-	targets, currentTargetsVersion, err = targetRepo.LoadTargets(false)
+	targets, currentTargetsVersion, err = targetRepo.LoadTargets(ctx, false)
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("%w: %w", ErrMetaUpdateFailed, err)
 	}
 	if s.UpdateTargets {
-		targets, newTargetsVersion, err = targetRepo.LoadTargets(s.UpdateTargets)
+		targets, newTargetsVersion, err = targetRepo.LoadTargets(ctx, s.UpdateTargets)
 		if err != nil {
 			return fmt.Errorf("%w: %w", ErrMetaUpdateFailed, err)
 		}
@@ -253,7 +249,7 @@ func (u *UpdateContext) isTargetInSync(ctx context.Context) (bool, error) {
 	}
 
 	for _, appURI := range u.ToTarget.AppURIs() {
-		appStatus, ok := u.CurrentStatus.AppStatuses[appURI]
+		appStatus, ok := u.CurrentStatus.GetAppStatus(appURI)
 		if !ok {
 			slog.Debug("Required app is not present on the host", "app", appURI)
 			return false, nil
@@ -298,7 +294,8 @@ func (u *UpdateContext) getAndSetCurrentTarget() error {
 	u.FromTarget = target.UnknownTarget
 	lastUpdate, err := update.GetLastSuccessfulUpdate(u.Config.ComposeConfig())
 	if err != nil {
-		return fmt.Errorf("no last successful update found: %w", err)
+		slog.Debug("no last successful update found, trying the current target of installed versions", "error", err)
+		return u.getAndSetCurrentTargetFromInstalledVersions()
 	}
 	if target := u.Targets.GetTargetByID(lastUpdate.ClientRef); !target.IsUnknown() {
 		target.ShortlistAppsByURI(lastUpdate.URIs)
@@ -316,6 +313,25 @@ func (u *UpdateContext) getAndSetCurrentTarget() error {
 	}
 }
 
+// getAndSetCurrentTargetFromInstalledVersions sets the current target from the installed_versions table.
+// It is used when the compose update DB is missing, e.g. on a device migrated from aktualizr-lite.
+func (u *UpdateContext) getAndSetCurrentTargetFromInstalledVersions() error {
+	current, err := targets.GetCurrentTarget(u.Config.GetDBPath())
+	if err != nil {
+		return fmt.Errorf("failed to get current target from installed versions: %w", err)
+	}
+	if current.IsUnknown() {
+		return fmt.Errorf("no current target found in installed versions")
+	}
+	if target := u.Targets.GetTargetByID(current.ID); !target.IsUnknown() {
+		target.ShortlistAppsByURI(current.AppURIs())
+		u.FromTarget = target
+		return nil
+	}
+	u.FromTarget = current
+	return nil
+}
+
 func (u *UpdateContext) getOngoingUpdateTarget() (*target.Target, error) {
 	ongoingUpdate := u.UpdateRunner.Status()
 	if target := u.Targets.GetTargetByID(ongoingUpdate.ClientRef); !target.IsUnknown() {
@@ -332,26 +348,41 @@ func (u *UpdateContext) getOngoingUpdateTarget() (*target.Target, error) {
 	return target, nil
 }
 
-func (u *UpdateContext) sendMetadataUpdateCompletedEvent(currentTargetsVersion, newTargetsVersion int, err error) {
+func (u *UpdateContext) sendMetadataUpdateCompletedEvent(currentTargetsVersion, newTargetsVersion int,
+	versions target.MetadataVersions, bytesSaved int64, err error) {
 	type metadataUpdateDetails struct {
-		FromVersion int `json:"from_version"`
-		ToVersion   int `json:"to_version"`
+		FromVersion     int `json:"from_version"`
+		ToVersion       int `json:"to_version"`
+		RootVersion     int `json:"root_version,omitempty"`
+		SnapshotVersion int `json:"snapshot_version,omitempty"`
+		// Bytes not downloaded thanks to the conditional requests made since the previous version was received
+		BytesSaved int64 `json:"bytes_saved,omitempty"`
 	}
 	type metadataUpdateErrDetails struct {
-		CurrentVersion int    `json:"current_version"`
-		Error          string `json:"error"`
-	}
+		CurrentVersion  int    `json:"current_version"`
+		RootVersion     int    `json:"root_version,omitempty"`
+		SnapshotVersion int    `json:"snapshot_version,omitempty"`
+		Error           string `json:"error"`
+	}
+	// The root and snapshot versions are reported only by the TUF repo
+	rootVersion := max(versions.Root, 0)
+	snapshotVersion := max(versions.Snapshot, 0)
 	var details interface{}
 	if err != nil {
 		details = metadataUpdateErrDetails{
-			CurrentVersion: currentTargetsVersion,
-			Error:          err.Error(),
+			CurrentVersion:  currentTargetsVersion,
+			RootVersion:     rootVersion,
+			SnapshotVersion: snapshotVersion,
+			Error:           err.Error(),
 		}
 	} else if newTargetsVersion != -1 {
 		// Only send details if we have a valid new version, indicating that an update was performed
 		details = metadataUpdateDetails{
-			FromVersion: currentTargetsVersion,
-			ToVersion:   newTargetsVersion,
+			FromVersion:     currentTargetsVersion,
+			ToVersion:       newTargetsVersion,
+			RootVersion:     rootVersion,
+			SnapshotVersion: snapshotVersion,
+			BytesSaved:      bytesSaved,
 		}
 	}
 
@@ -6,9 +6,11 @@ package state
 import (
 	"context"
 	"fmt"
+	"log/slog"
 
 	"github.com/foundriesio/composeapp/pkg/update"
 	"github.com/foundriesio/fioup/internal/events"
+	"github.com/foundriesio/fioup/internal/targets"
 	"github.com/pkg/errors"
 )
 
@@ -36,6 +38,11 @@ func (s *Init) Execute(ctx context.Context, updateCtx *UpdateContext) error {
 	}
 	var wasInitialized bool
 	if state == update.StateCreated || state == update.StateInitializing {
+		if failing, err := targets.IsFailingTarget(updateCtx.Config.GetDBPath(), updateCtx.ToTarget.ID); err != nil {
+			slog.Debug("failed to check whether the target failed to install before", "error", err)
+		} else if failing {
+			slog.Warn("Installation of the target has failed before", "target_id", updateCtx.ToTarget.ID)
+		}
 		updateCtx.SendEvent(events.UpdateInitStarted)
 		err = updateCtx.UpdateRunner.Init(ctx, apps,
 			update.WithInitAllowEmptyAppList(true),
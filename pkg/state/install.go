@@ -11,6 +11,7 @@ import (
 	"github.com/foundriesio/composeapp/pkg/compose"
 	"github.com/foundriesio/composeapp/pkg/update"
 	"github.com/foundriesio/fioup/internal/events"
+	"github.com/foundriesio/fioup/internal/targets"
 	"github.com/foundriesio/fioup/pkg/status"
 	"github.com/pkg/errors"
 )
@@ -34,6 +35,7 @@ func (s *Install) Execute(ctx context.Context, updateCtx *UpdateContext) error {
 	if s.ProgressHandler != nil {
 		opts = append(opts, compose.WithInstallProgress(s.ProgressHandler))
 	}
+	updateCtx.registerInstallation(targets.RegisterInstallationStarted)
 	err := updateCtx.UpdateRunner.Install(ctx, opts...)
 	if err == nil {
 		updateCtx.SendEvent(events.InstallationApplied)
@@ -44,6 +46,7 @@ func (s *Install) Execute(ctx context.Context, updateCtx *UpdateContext) error {
 		} else {
 			slog.Error("failed to get current app statuses after install failure", "error", errStatus)
 		}
+		updateCtx.registerInstallation(targets.RegisterInstallationFailed)
 		updateCtx.SendEvent(events.InstallationCompleted, err)
 		err = fmt.Errorf("%w: %w", ErrInstallFailed, err)
 	}
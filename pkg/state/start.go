@@ -11,6 +11,7 @@ import (
 	"github.com/foundriesio/composeapp/pkg/compose"
 	"github.com/foundriesio/composeapp/pkg/update"
 	"github.com/foundriesio/fioup/internal/events"
+	"github.com/foundriesio/fioup/internal/targets"
 	"github.com/foundriesio/fioup/pkg/status"
 	"github.com/pkg/errors"
 )
@@ -38,7 +39,9 @@ func (s *Start) Execute(ctx context.Context, updateCtx *UpdateContext) error {
 	if err == nil {
 		updateCtx.completeUpdate(ctx)
 		updateCtx.Client.UpdateHeaders(updateCtx.ToTarget.AppNames(), updateCtx.ToTarget.ID)
+		updateCtx.registerInstallation(targets.RegisterInstallationSuceeded)
 	} else {
+		updateCtx.registerInstallation(targets.RegisterInstallationFailed)
 		err = fmt.Errorf("%w: %w", ErrStartFailed, err)
 	}
 	if currentStatus, errStatus := status.GetCurrentStatus(ctx, updateCtx.Config.ComposeConfig()); errStatus == nil {
@@ -120,6 +120,14 @@ func (u *UpdateContext) SendEvent(event events.EventTypeValue, eventErr ...error
 	}
 }
 
+// registerInstallation records the installation of the target being installed in the installed_versions table,
+// which is shared with aktualizr-lite and read by tooling that expects it to reflect the device state
+func (u *UpdateContext) registerInstallation(register func(string, *target.Target, string) error) {
+	if err := register(u.Config.GetDBPath(), &u.ToTarget, u.UpdateRunner.Status().ID); err != nil {
+		slog.Error("failed to register installation", "target_id", u.ToTarget.ID, "error", err)
+	}
+}
+
 func (u *UpdateContext) getUpdateDetails(eventType events.EventTypeValue, eventErr error) string {
 	var detailsString string
 	var details interface{}
@@ -150,9 +158,16 @@ func (u *UpdateContext) getUpdateDetails(eventType events.EventTypeValue, eventE
 }
 
 func (u *UpdateContext) getUpdateInitStartedDetails() interface{} {
+	type appDigestDelta struct {
+		App  string `json:"app"`
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
 	type UpdateFromTo struct {
 		From []string `json:"from"`
 		To   []string `json:"to"`
+		// Digests lists the digest change of each updated app
+		Digests []appDigestDelta `json:"digests,omitempty"`
 	}
 	type actionsType struct {
 		Remove []string     `json:"remove"`
@@ -181,6 +196,12 @@ func (u *UpdateContext) getUpdateInitStartedDetails() interface{} {
 		reason = "sync the current target; one or more apps are out of sync - not fetched or not installed or not running," +
 			" see 'current_status' for details"
 	}
+	var digests []appDigestDelta
+	for i, from := range u.AppDiff.Update {
+		if i < len(u.AppDiff.UpdateTo) {
+			digests = append(digests, appDigestDelta{App: from.Name, From: from.Digest(), To: u.AppDiff.UpdateTo[i].Digest()})
+		}
+	}
 	return &updateInitStartedDetails{
 		FromTarget: u.FromTarget.ID,
 		ToTarget:   u.ToTarget.ID,
@@ -191,8 +212,9 @@ func (u *UpdateContext) getUpdateInitStartedDetails() interface{} {
 			Add:    u.AppDiff.Add.URIs(),
 			Sync:   u.AppDiff.Sync.URIs(),
 			Update: UpdateFromTo{
-				From: u.AppDiff.Update.URIs(),
-				To:   u.AppDiff.UpdateTo.URIs(),
+				From:    u.AppDiff.Update.URIs(),
+				To:      u.AppDiff.UpdateTo.URIs(),
+				Digests: digests,
 			},
 		},
 		CurrentStatus: currentStatus,
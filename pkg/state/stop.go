@@ -51,13 +51,15 @@ func (s *Stop) Execute(ctx context.Context, updateCtx *UpdateContext) error {
 				appsToStop = append(appsToStop, app)
 				continue
 			}
-			appStatus, ok := updateCtx.CurrentStatus.AppStatuses[app.URI]
+			appStatus, ok := updateCtx.CurrentStatus.GetAppStatus(app.URI)
 			if !ok {
 				appsToStop = append(appsToStop, app)
 				slog.Warn("app in sync list not found in current status", "appURI", app.URI)
 				continue
 			}
-			if !appStatus.Running || !appStatus.Installed || !appStatus.Fetched {
+			if !appStatus.IsInSync() {
+				slog.Debug("app in sync list is not healthy, will be stopped", "app", app.Name,
+					"fetched", appStatus.Fetched, "installed", appStatus.Installed, "running", appStatus.Running)
 				appsToStop = append(appsToStop, app)
 				continue
 			}
@@ -0,0 +1,159 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/foundriesio/composeapp/pkg/compose"
+)
+
+type (
+	ServiceStatus struct {
+		Name          string     `json:"name"`
+		ContainerID   string     `json:"container_id,omitempty"`
+		ImageDigest   string     `json:"image_digest,omitempty"`
+		State         string     `json:"state"`
+		Status        string     `json:"status,omitempty"`
+		Health        string     `json:"health,omitempty"`
+		RestartCount  int        `json:"restart_count"`
+		StartedAt     *time.Time `json:"started_at,omitempty"`
+		UptimeSeconds int64      `json:"uptime_seconds,omitempty"`
+		Ports         []string   `json:"ports,omitempty"`
+		LastExitCode  *int       `json:"last_exit_code,omitempty"`
+	}
+
+	CurrentStatusOpts struct {
+		// Inspect the app containers to get the restart count, uptime, ports and exit code of services
+		ServiceDetails bool
+	}
+	CurrentStatusOpt func(*CurrentStatusOpts)
+)
+
+func WithServiceDetails(enabled bool) CurrentStatusOpt {
+	return func(o *CurrentStatusOpts) {
+		o.ServiceDetails = enabled
+	}
+}
+
+func getCurrentStatusOpts(options ...CurrentStatusOpt) *CurrentStatusOpts {
+	opts := &CurrentStatusOpts{}
+	for _, o := range options {
+		o(opts)
+	}
+	return opts
+}
+
+// Uptime returns for how long the service container has been running, or zero if it is not running.
+func (s *ServiceStatus) Uptime() time.Duration {
+	return time.Duration(s.UptimeSeconds) * time.Second
+}
+
+// getServiceStatuses returns the status of the given app's services as reported by the running status check.
+// The services of the running report are ordered the same way as the app's images, so the image digest
+// of each service is taken from the corresponding image node of the app's compose tree.
+func getServiceStatuses(s *compose.AppsStatus, app compose.App) []ServiceStatus {
+	if s.RunningStatus == nil {
+		return nil
+	}
+	report, ok := s.AppsRunningStatus[app.Ref().Digest]
+	if !ok {
+		return nil
+	}
+	var imageNodes []*compose.TreeNode
+	if root := app.GetComposeRoot(); root != nil {
+		imageNodes = root.Children
+	}
+	services := make([]ServiceStatus, 0, len(report.Services))
+	for i, srv := range report.Services {
+		if srv == nil {
+			continue
+		}
+		service := ServiceStatus{
+			Name:        srv.Name,
+			ContainerID: srv.CtrID,
+			State:       srv.State,
+			Status:      srv.Status,
+			Health:      srv.Health,
+		}
+		if i < len(imageNodes) && imageNodes[i] != nil {
+			service.ImageDigest = imageNodes[i].Descriptor.Digest.String()
+		}
+		services = append(services, service)
+	}
+	return services
+}
+
+// inspectServices adds the details that are available only by inspecting containers to the given services.
+// Failure to inspect a container is not fatal, the service is reported without the details in this case.
+func inspectServices(ctx context.Context, cfg *compose.Config, appStatuses map[string]AppStatus) error {
+	cli, err := compose.GetDockerClient(cfg.DockerHost)
+	if err != nil {
+		return fmt.Errorf("failed to create docker client: %w", err)
+	}
+	defer cli.Close()
+	now := time.Now()
+	for _, appStatus := range appStatuses {
+		for i := range appStatus.Services {
+			if appStatus.Services[i].ContainerID == "" {
+				continue
+			}
+			if err := inspectService(ctx, cli, &appStatus.Services[i], now); err != nil {
+				slog.Debug("failed to inspect service container", "app", appStatus.Name,
+					"service", appStatus.Services[i].Name, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+func inspectService(ctx context.Context, cli *client.Client, service *ServiceStatus, now time.Time) error {
+	info, err := cli.ContainerInspect(ctx, service.ContainerID)
+	if err != nil {
+		return err
+	}
+	setContainerDetails(service, &info, now)
+	return nil
+}
+
+// setContainerDetails sets the restart count, start time, uptime, exit code and ports of the service
+// from the inspected info of its container
+func setContainerDetails(service *ServiceStatus, info *types.ContainerJSON, now time.Time) {
+	if info.ContainerJSONBase == nil {
+		return
+	}
+	service.RestartCount = info.RestartCount
+	if state := info.State; state != nil {
+		if startedAt, err := time.Parse(time.RFC3339Nano, state.StartedAt); err == nil && !startedAt.IsZero() {
+			service.StartedAt = &startedAt
+			if state.Running {
+				service.UptimeSeconds = int64(now.Sub(startedAt).Seconds())
+			}
+		}
+		// Report the exit code of services that have stopped or are being restarted after a crash
+		if !state.Running || state.Restarting {
+			exitCode := state.ExitCode
+			service.LastExitCode = &exitCode
+		}
+	}
+	if info.NetworkSettings != nil {
+		for port, bindings := range info.NetworkSettings.Ports {
+			if len(bindings) == 0 {
+				service.Ports = append(service.Ports, string(port))
+				continue
+			}
+			for _, b := range bindings {
+				service.Ports = append(service.Ports, fmt.Sprintf("%s:%s->%s", b.HostIP, b.HostPort, port))
+			}
+		}
+		slices.Sort(service.Ports)
+		service.Ports = slices.Compact(service.Ports)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetServiceStatuses(t *testing.T) {
+	app := newTestApp("shop", "web", "db", "cache")
+	other := newTestApp("other", "api")
+	s := newTestAppsStatus(app, other)
+	report := s.AppsRunningStatus[app.ref.Digest]
+	report.Services[1].State = "exited"
+	report.Services[1].Status = "Exited (1) 5 minutes ago"
+	report.Services[2].Health = "unhealthy"
+
+	// The image of each service is the image node of the app's compose tree with the same index
+	services := getServiceStatuses(s, app)
+	require.Equal(t, []ServiceStatus{
+		{Name: "web", ContainerID: "shop-web", ImageDigest: app.images[0].String(), State: "running"},
+		{Name: "db", ContainerID: "shop-db", ImageDigest: app.images[1].String(), State: "exited", Status: "Exited (1) 5 minutes ago"},
+		{Name: "cache", ContainerID: "shop-cache", ImageDigest: app.images[2].String(), State: "running", Health: "unhealthy"},
+	}, services)
+	require.Equal(t, []ServiceStatus{
+		{Name: "api", ContainerID: "other-api", ImageDigest: other.images[0].String(), State: "running"},
+	}, getServiceStatuses(s, other))
+
+	// The services without an image node are reported without the image digest
+	app.images = app.images[:1]
+	report.Services[1] = nil
+	services = getServiceStatuses(s, app)
+	require.Len(t, services, 2)
+	require.Equal(t, app.images[0].String(), services[0].ImageDigest)
+	require.Equal(t, "cache", services[1].Name)
+	require.Empty(t, services[1].ImageDigest)
+
+	delete(s.AppsRunningStatus, app.ref.Digest)
+	require.Nil(t, getServiceStatuses(s, app))
+	s.RunningStatus = nil
+	require.Nil(t, getServiceStatuses(s, other))
+}
+
+// The relevant part of `docker inspect` output of a service container
+const testContainerInspect = `{
+	"Id": "3f2a9c1d7e6b",
+	"RestartCount": 3,
+	"State": {
+		"Status": "%s",
+		"Running": %t,
+		"Restarting": %t,
+		"ExitCode": %d,
+		"StartedAt": "2026-10-18T10:00:00.123456789Z",
+		"FinishedAt": "2026-10-18T09:59:58Z"
+	},
+	"NetworkSettings": {
+		"Ports": {
+			"80/tcp": [{"HostIp": "0.0.0.0", "HostPort": "8080"}, {"HostIp": "::", "HostPort": "8080"}],
+			"443/tcp": [{"HostIp": "0.0.0.0", "HostPort": "8443"}, {"HostIp": "0.0.0.0", "HostPort": "8443"}],
+			"9090/tcp": null
+		}
+	}
+}`
+
+func TestSetContainerDetails(t *testing.T) {
+	startedAt := time.Date(2026, 10, 18, 10, 0, 0, 123456789, time.UTC)
+	now := startedAt.Add(90 * time.Minute)
+	ports := []string{"0.0.0.0:8080->80/tcp", "0.0.0.0:8443->443/tcp", "9090/tcp", ":::8080->80/tcp"}
+	tests := []struct {
+		name       string
+		state      string
+		running    bool
+		restarting bool
+		exitCode   int
+		uptime     int64
+		lastExit   *int
+	}{
+		{name: "running", state: "running", running: true, uptime: 5400},
+		{name: "exited", state: "exited", exitCode: 137, lastExit: intPointer(137)},
+		{name: "exited successfully", state: "exited", lastExit: intPointer(0)},
+		{name: "restarting", state: "restarting", running: true, restarting: true, exitCode: 1, uptime: 5400, lastExit: intPointer(1)},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var info types.ContainerJSON
+			fixture := fmt.Sprintf(testContainerInspect, tc.state, tc.running, tc.restarting, tc.exitCode)
+			require.Nil(t, json.Unmarshal([]byte(fixture), &info))
+
+			service := ServiceStatus{Name: "web", ContainerID: "3f2a9c1d7e6b"}
+			setContainerDetails(&service, &info, now)
+			require.Equal(t, 3, service.RestartCount)
+			require.NotNil(t, service.StartedAt)
+			require.True(t, startedAt.Equal(*service.StartedAt))
+			require.Equal(t, tc.uptime, service.UptimeSeconds)
+			require.Equal(t, tc.lastExit, service.LastExitCode)
+			// The ports are sorted and the duplicated bindings are reported once
+			require.Equal(t, ports, service.Ports)
+		})
+	}
+
+	// A container that has never started
+	var info types.ContainerJSON
+	require.Nil(t, json.Unmarshal([]byte(`{"Id": "3f2a9c1d7e6b", "State": {"Status": "created", "StartedAt": "0001-01-01T00:00:00Z"}}`), &info))
+	service := ServiceStatus{Name: "web"}
+	setContainerDetails(&service, &info, now)
+	require.Nil(t, service.StartedAt)
+	require.Zero(t, service.UptimeSeconds)
+	require.Empty(t, service.Ports)
+
+	// Nothing is set if the container info is missing
+	service = ServiceStatus{Name: "web"}
+	setContainerDetails(&service, &types.ContainerJSON{}, now)
+	require.Equal(t, ServiceStatus{Name: "web"}, service)
+}
+
+func intPointer(i int) *int {
+	return &i
+}
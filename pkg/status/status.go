@@ -19,6 +19,8 @@ type (
 		Fetched   bool   `json:"fetched"`
 		Installed bool   `json:"installed"`
 		Running   bool   `json:"running"`
+		// Status of the app's services, in the order of the app's images
+		Services []ServiceStatus `json:"services,omitempty"`
 	}
 
 	CurrentStatus struct {
@@ -46,7 +48,8 @@ type (
 	}
 )
 
-func GetCurrentStatus(ctx context.Context, cfg *compose.Config) (*CurrentStatus, error) {
+func GetCurrentStatus(ctx context.Context, cfg *compose.Config, options ...CurrentStatusOpt) (*CurrentStatus, error) {
+	opts := getCurrentStatusOpts(options...)
 	currentStatus := CurrentStatus{
 		AppStatuses: map[string]AppStatus{},
 	}
@@ -67,23 +70,73 @@ func GetCurrentStatus(ctx context.Context, cfg *compose.Config) (*CurrentStatus,
 		return nil, fmt.Errorf("failed to check apps' status: %w", err)
 	}
 
-	areFetched := s.AreFetched()
-	areInstalled := s.AreInstalled()
-	areRunning := s.AreRunning()
-
 	for _, app := range s.Apps {
 		currentStatus.AppStatuses[app.Ref().String()] = AppStatus{
-			URI:  app.Ref().String(),
-			Name: app.Name(),
-			// TODO: per-app status check instead of global, add wrapper functions over `compose.AppsStatus` for that
-			Fetched:   areFetched,
-			Installed: areInstalled,
-			Running:   areRunning,
+			URI:       app.Ref().String(),
+			Name:      app.Name(),
+			Fetched:   isAppFetched(s, app),
+			Installed: isAppInstalled(s, app),
+			Running:   isAppRunning(s, app),
+			Services:  getServiceStatuses(s, app),
+		}
+	}
+	if opts.ServiceDetails {
+		if err := inspectServices(ctx, cfg, currentStatus.AppStatuses); err != nil {
+			return nil, err
 		}
 	}
 	return &currentStatus, nil
 }
 
+// isAppFetched returns true if all blobs of the given app are present in the local store.
+func isAppFetched(s *compose.AppsStatus, app compose.App) bool {
+	if s.FetchStatus == nil {
+		return false
+	}
+	report, ok := s.BlobsStatus[app.Ref().Digest]
+	if !ok {
+		return false
+	}
+	for _, blob := range report.BlobsStatus {
+		if blob.State != compose.BlobOk {
+			return false
+		}
+	}
+	return true
+}
+
+// isAppInstalled returns true if the given app's compose project and all its images are installed.
+func isAppInstalled(s *compose.AppsStatus, app compose.App) bool {
+	if s.InstallStatus == nil {
+		return false
+	}
+	report, ok := s.AppsInstallStatus[app.Ref().Digest]
+	if !ok || report == nil || len(report.BundleErrors) > 0 {
+		return false
+	}
+	if _, notInstalled := s.NotInstalledCompose[app.Ref().Digest]; notInstalled {
+		return false
+	}
+	for _, installed := range report.Images {
+		if !installed {
+			return false
+		}
+	}
+	return true
+}
+
+// isAppRunning returns true if all services of the given app are running (or exited successfully).
+func isAppRunning(s *compose.AppsStatus, app compose.App) bool {
+	if s.RunningStatus == nil {
+		return false
+	}
+	if _, ok := s.AppsRunningStatus[app.Ref().Digest]; !ok {
+		return false
+	}
+	_, notRunning := s.NotRunningApps[app.Ref().Digest]
+	return !notRunning
+}
+
 func GetUpdateStatus(cfg *compose.Config) (*UpdateStatus, error) {
 	s, err := update.GetLastUpdate(cfg)
 	if err != nil {
@@ -108,6 +161,29 @@ func GetUpdateStatus(cfg *compose.Config) (*UpdateStatus, error) {
 	}, nil
 }
 
+// GetAppStatus returns the status of the app with the given URI. If there is no status for the exact URI,
+// the status of the app with the same name and digest is returned, as the URI may be written differently.
+func (s *CurrentStatus) GetAppStatus(appURI string) (AppStatus, bool) {
+	if appStatus, ok := s.AppStatuses[appURI]; ok {
+		return appStatus, true
+	}
+	ref, err := compose.ParseAppRef(appURI)
+	if err != nil {
+		return AppStatus{}, false
+	}
+	for uri, appStatus := range s.AppStatuses {
+		if r, err := compose.ParseAppRef(uri); err == nil && r.Name == ref.Name && r.Digest == ref.Digest {
+			return appStatus, true
+		}
+	}
+	return AppStatus{}, false
+}
+
+// IsInSync returns true if the app is fetched, installed and running.
+func (s AppStatus) IsInSync() bool {
+	return s.Fetched && s.Installed && s.Running
+}
+
 func (s *CurrentStatus) AppStatusList() []AppStatus {
 	appStatuses := make([]AppStatus, 0, len(s.AppStatuses))
 	for _, appStatus := range s.AppStatuses {
@@ -118,7 +194,7 @@ func (s *CurrentStatus) AppStatusList() []AppStatus {
 
 func (s *CurrentStatus) AreAppsHealthy() bool {
 	for _, appStatus := range s.AppStatuses {
-		if !appStatus.Running || !appStatus.Installed || !appStatus.Fetched {
+		if !appStatus.IsInSync() {
 			return false
 		}
 	}
@@ -0,0 +1,165 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package status
+
+import (
+	"testing"
+
+	"github.com/foundriesio/composeapp/pkg/compose"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// testApp is an app whose compose tree has an image node per service
+type testApp struct {
+	compose.App
+	ref      *compose.AppRef
+	services []string
+	images   []digest.Digest
+}
+
+func newTestApp(name string, services ...string) *testApp {
+	app := &testApp{ref: &compose.AppRef{Name: name, Digest: digest.FromString(name)}, services: services}
+	for _, s := range services {
+		app.images = append(app.images, digest.FromString(name+"/"+s))
+	}
+	return app
+}
+
+func (a *testApp) Name() string         { return a.ref.Name }
+func (a *testApp) Ref() *compose.AppRef { return a.ref }
+func (a *testApp) GetComposeRoot() *compose.TreeNode {
+	root := &compose.TreeNode{Descriptor: &ocispec.Descriptor{Digest: a.ref.Digest}}
+	for _, image := range a.images {
+		root.Children = append(root.Children, &compose.TreeNode{Descriptor: &ocispec.Descriptor{Digest: image}})
+	}
+	return root
+}
+
+// newTestAppsStatus returns the status of the given apps as if they were fetched, installed and running
+func newTestAppsStatus(apps ...*testApp) *compose.AppsStatus {
+	s := &compose.AppsStatus{
+		FetchStatus:   &compose.FetchStatus{BlobsStatus: map[digest.Digest]compose.FetchReport{}},
+		InstallStatus: &compose.InstallStatus{AppsInstallStatus: map[digest.Digest]*compose.InstallReport{}},
+		RunningStatus: &compose.RunningStatus{AppsRunningStatus: map[digest.Digest]compose.RunningReport{}},
+	}
+	for _, app := range apps {
+		s.Apps = append(s.Apps, app)
+		blobs := compose.BlobsInfo{app.ref.Digest: {State: compose.BlobOk}}
+		images := map[digest.Digest]bool{}
+		var services []*compose.Service
+		for i, image := range app.images {
+			blobs[image] = &compose.BlobInfo{State: compose.BlobOk}
+			images[image] = true
+			services = append(services, &compose.Service{
+				Name:  app.services[i],
+				CtrID: app.ref.Name + "-" + app.services[i],
+				State: "running",
+			})
+		}
+		s.BlobsStatus[app.ref.Digest] = compose.FetchReport{BlobsStatus: blobs}
+		s.AppsInstallStatus[app.ref.Digest] = &compose.InstallReport{Images: images}
+		s.AppsRunningStatus[app.ref.Digest] = compose.RunningReport{Services: services}
+	}
+	return s
+}
+
+func TestAppStatusChecks(t *testing.T) {
+	tests := []struct {
+		name      string
+		breakApp  func(s *compose.AppsStatus, app *testApp)
+		fetched   bool
+		installed bool
+		running   bool
+	}{
+		{
+			name:     "healthy",
+			breakApp: func(s *compose.AppsStatus, app *testApp) {},
+			fetched:  true, installed: true, running: true,
+		},
+		{
+			name: "missing blob",
+			breakApp: func(s *compose.AppsStatus, app *testApp) {
+				s.BlobsStatus[app.ref.Digest].BlobsStatus[app.images[1]].State = compose.BlobMissing
+			},
+			fetched: false, installed: true, running: true,
+		},
+		{
+			name: "no fetch report",
+			breakApp: func(s *compose.AppsStatus, app *testApp) {
+				delete(s.BlobsStatus, app.ref.Digest)
+			},
+			fetched: false, installed: true, running: true,
+		},
+		{
+			name: "image not installed",
+			breakApp: func(s *compose.AppsStatus, app *testApp) {
+				s.AppsInstallStatus[app.ref.Digest].Images[app.images[0]] = false
+			},
+			fetched: true, installed: false, running: true,
+		},
+		{
+			name: "bundle errors",
+			breakApp: func(s *compose.AppsStatus, app *testApp) {
+				s.AppsInstallStatus[app.ref.Digest].BundleErrors = compose.AppBundleErrs{"docker-compose.yml": "missing"}
+			},
+			fetched: true, installed: false, running: true,
+		},
+		{
+			name: "compose project not installed",
+			breakApp: func(s *compose.AppsStatus, app *testApp) {
+				s.NotInstalledCompose = map[digest.Digest]interface{}{app.ref.Digest: nil}
+			},
+			fetched: true, installed: false, running: true,
+		},
+		{
+			name: "no install report",
+			breakApp: func(s *compose.AppsStatus, app *testApp) {
+				s.AppsInstallStatus[app.ref.Digest] = nil
+			},
+			fetched: true, installed: false, running: true,
+		},
+		{
+			name: "not running",
+			breakApp: func(s *compose.AppsStatus, app *testApp) {
+				s.NotRunningApps = map[digest.Digest]interface{}{app.ref.Digest: nil}
+			},
+			fetched: true, installed: true, running: false,
+		},
+		{
+			name: "no running report",
+			breakApp: func(s *compose.AppsStatus, app *testApp) {
+				delete(s.AppsRunningStatus, app.ref.Digest)
+			},
+			fetched: true, installed: true, running: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			healthy := newTestApp("healthy", "web", "db")
+			broken := newTestApp("broken", "api", "worker")
+			s := newTestAppsStatus(healthy, broken)
+			tc.breakApp(s, broken)
+
+			// The failure of an app does not affect the status of the other apps
+			require.True(t, isAppFetched(s, healthy))
+			require.True(t, isAppInstalled(s, healthy))
+			require.True(t, isAppRunning(s, healthy))
+
+			require.Equal(t, tc.fetched, isAppFetched(s, broken))
+			require.Equal(t, tc.installed, isAppInstalled(s, broken))
+			require.Equal(t, tc.running, isAppRunning(s, broken))
+		})
+	}
+}
+
+func TestAppStatusChecks_NotChecked(t *testing.T) {
+	app := newTestApp("healthy", "web")
+	s := newTestAppsStatus(app)
+	s.FetchStatus, s.InstallStatus, s.RunningStatus = nil, nil, nil
+	require.False(t, isAppFetched(s, app))
+	require.False(t, isAppInstalled(s, app))
+	require.False(t, isAppRunning(s, app))
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package target
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/foundriesio/composeapp/pkg/compose"
+)
+
+type (
+	// DiscardedTarget is a target found in the targets metadata that cannot be installed on the device
+	DiscardedTarget struct {
+		Target
+		Reason string `json:"reason"`
+	}
+
+	// targetFilter selects the targets that can be installed on the device
+	targetFilter struct {
+		hardwareID string
+		// tags the target must have one of; any tag is accepted if empty
+		tags []string
+		// arch is the platform architecture the target must be built for; any arch is accepted if empty
+		arch string
+	}
+)
+
+var (
+	// archAliases maps the architecture names used in the target metadata to the Go/OCI ones
+	archAliases = map[string]string{
+		"x86_64":  "amd64",
+		"x86-64":  "amd64",
+		"aarch64": "arm64",
+		"armhf":   "arm",
+		"armv7l":  "arm",
+		"armv7":   "arm",
+		"i386":    "386",
+		"i686":    "386",
+	}
+)
+
+// newTarget composes the target out of its custom metadata. If the target cannot be installed on the device,
+// the reason it is discarded is returned along with the target.
+func (f *targetFilter) newTarget(id string, custom *Custom) (Target, string) {
+	t := Target{ID: id, Version: -1, Custom: custom.Raw}
+	version, err := strconv.Atoi(custom.Version)
+	if err != nil {
+		return t, fmt.Sprintf("invalid version %q", custom.Version)
+	}
+	t.Version = version
+
+	if len(custom.HardwareID) == 0 {
+		return t, "no hardware ID"
+	}
+	if !slices.Contains(custom.HardwareID, f.hardwareID) {
+		return t, fmt.Sprintf("hardware ID %q is not one of %s", f.hardwareID, strings.Join(custom.HardwareID, ", "))
+	}
+	if len(f.tags) > 0 {
+		tags := t.Tags()
+		if !slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(f.tags, tag) }) {
+			return t, fmt.Sprintf("tags [%s] do not match any of configured tags [%s]",
+				strings.Join(tags, ", "), strings.Join(f.tags, ", "))
+		}
+	}
+	if f.arch != "" && custom.Arch != "" && normalizeArch(custom.Arch) != normalizeArch(f.arch) {
+		return t, fmt.Sprintf("arch %q does not match platform arch %q", custom.Arch, f.arch)
+	}
+
+	for appName, appField := range custom.Apps {
+		appRef, err := compose.ParseAppRef(appField.URI)
+		if err != nil {
+			slog.Error(
+				"failed to parse app URI in target",
+				"target", id,
+				"app", appName,
+				"uri", appField.URI,
+				"error", err,
+			)
+			return t, fmt.Sprintf("invalid URI of app %q: %s", appName, err)
+		}
+		// The app name embedded in the URI must match the app name declared
+		// in the target configuration. A mismatch indicates a misconfigured
+		// target. This validation is required because composectl derives the
+		// app name from the URI passed through its CLI or API.
+		if appRef.Name != appName {
+			slog.Error(
+				"app name mismatch between target and URI",
+				"target", id,
+				"target_app", appName,
+				"uri_app", appRef.Name,
+				"uri", appField.URI,
+			)
+			return t, fmt.Sprintf("app name %q does not match the name in its URI %q", appName, appRef.Name)
+		}
+		t.Apps = append(t.Apps, App{
+			Name: appName,
+			URI:  appField.URI,
+		})
+	}
+	return t, ""
+}
+
+func normalizeArch(arch string) string {
+	if alias, ok := archAliases[arch]; ok {
+		return alias
+	}
+	return arch
+}
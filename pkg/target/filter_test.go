@@ -0,0 +1,61 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package target
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetFilter(t *testing.T) {
+	appURI := "hub.foundries.io/factory/app1@sha256:c8087fe1b69ccc025c6cedb8747d98e132d7bf8be8081cb2403ebd3b6545ed6a"
+	newTarget := func(name, version, hwID, arch, tags, appName string) string {
+		apps := ""
+		if appName != "" {
+			apps = fmt.Sprintf(`"%s": {"uri": "%s"}`, appName, appURI)
+		}
+		return fmt.Sprintf(`"%s": {"custom": {"version": "%s", "hardwareIds": ["%s"], "arch": "%s", "tags": [%s],
+			"docker_compose_apps": {%s}}}`, name, version, hwID, arch, tags, apps)
+	}
+	targetsJson := fmt.Sprintf(`{"signed": {"version": 1, "targets": {%s}}}`, strings.Join([]string{
+		newTarget("valid-1", "1", "intel-corei7-64", "x86_64", `"main"`, "app1"),
+		newTarget("valid-2", "2", "intel-corei7-64", "", `"devel", "main"`, ""),
+		newTarget("bad-version", "latest", "intel-corei7-64", "x86_64", `"main"`, ""),
+		newTarget("other-hw", "3", "raspberrypi4-64", "aarch64", `"main"`, ""),
+		newTarget("other-tag", "4", "intel-corei7-64", "x86_64", `"devel"`, ""),
+		newTarget("no-tags", "5", "intel-corei7-64", "x86_64", ``, ""),
+		newTarget("other-arch", "6", "intel-corei7-64", "aarch64", `"main"`, ""),
+		newTarget("bad-app", "7", "intel-corei7-64", "x86_64", `"main"`, "app2"),
+	}, ","))
+
+	r := &plainRepo{filter: targetFilter{hardwareID: "intel-corei7-64", tags: []string{"main", "qa"}, arch: "amd64"}}
+	require.Nil(t, r.loadTargets([]byte(targetsJson)))
+	var selected []string
+	for _, target := range r.targets {
+		selected = append(selected, target.ID)
+	}
+	slices.Sort(selected)
+	require.Equal(t, []string{"valid-1", "valid-2"}, selected)
+
+	reasons := map[string]string{}
+	for _, d := range r.DiscardedTargets() {
+		reasons[d.ID] = d.Reason
+	}
+	require.Len(t, reasons, 6)
+	require.Contains(t, reasons["bad-version"], "invalid version")
+	require.Contains(t, reasons["other-hw"], "hardware ID")
+	require.Contains(t, reasons["other-tag"], "tags")
+	require.Contains(t, reasons["no-tags"], "tags")
+	require.Contains(t, reasons["other-arch"], "arch")
+	require.Contains(t, reasons["bad-app"], "app name")
+
+	// No tags and no arch configured
+	r = &plainRepo{filter: targetFilter{hardwareID: "intel-corei7-64"}}
+	require.Nil(t, r.loadTargets([]byte(targetsJson)))
+	require.Len(t, r.targets, 5)
+}
@@ -4,24 +4,27 @@
 package target
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
-	"strconv"
+	"time"
 
-	"github.com/foundriesio/composeapp/pkg/compose"
 	"github.com/foundriesio/fioup/pkg/client"
 )
 
 type (
 	plainRepo struct {
-		dgClient        *client.GatewayClient
-		targetsFilepath string
-		targets         []Target
-		hardwareID      string
-		version         int
+		dgClient   *client.GatewayClient
+		store      *MetadataStore
+		targets    []Target
+		discarded  []DiscardedTarget
+		filter     targetFilter
+		version    int
+		verifier   *targetsVerifier
+		bytesSaved int64
+		readOnly   bool
 	}
 )
 
@@ -29,19 +32,61 @@ const (
 	TargetsResourcePath = "/repo/targets.json"
 )
 
-func NewPlainRepo(dgClient *client.GatewayClient, targetsFilepath string, hardwareID string) (Repo, error) {
-	return &plainRepo{
-		dgClient:        dgClient,
-		targetsFilepath: targetsFilepath,
-		hardwareID:      hardwareID,
-	}, nil
+func NewPlainRepo(dgClient *client.GatewayClient, targetsFilepath string, hardwareID string, options ...RepoOpt) (Repo, error) {
+	opts := getRepoOpts(options...)
+	r := &plainRepo{
+		dgClient: dgClient,
+		store:    NewMetadataStore(targetsFilepath, opts.TargetsHistorySize),
+		filter:   opts.filter(hardwareID),
+		readOnly: opts.ReadOnly,
+	}
+	if opts.TargetsKeysFile != "" {
+		verifier, err := newTargetsVerifier(opts.TargetsKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		r.verifier = verifier
+	}
+	return r, nil
 }
 
-func (r *plainRepo) update() error {
-	res, err := r.dgClient.Get(TargetsResourcePath)
+func (r *plainRepo) update(ctx context.Context) error {
+	// Make a conditional request if the cached metadata is the version the stored validators belong to
+	var headers map[string]string
+	cached, cacheErr := r.store.Load()
+	validators := r.store.Validators()
+	if cacheErr == nil && validators != nil {
+		if version, err := parseMetadata(cached); err == nil && version == validators.Version {
+			headers = validators.RequestHeaders()
+		}
+	}
+	res, err := r.dgClient.GetWithHeaders(ctx, TargetsResourcePath, headers)
 	if err != nil {
 		return fmt.Errorf("failed to get targets from Device Gateway: %w", err)
 	}
+	if res.StatusCode == http.StatusNotModified && len(headers) > 0 {
+		// The cached metadata could have expired since it was received
+		if r.verifier != nil {
+			if err := r.verifier.verify(cached, time.Now()); err != nil {
+				return err
+			}
+		}
+		// The bytes saved are stored along with the validators, so they are counted across the runs of fioup
+		updated := *validators
+		updated.BytesSaved += int64(len(cached))
+		if etag := res.Header.Get("ETag"); etag != "" {
+			updated.ETag = etag
+		}
+		if lastModified := res.Header.Get("Last-Modified"); lastModified != "" {
+			updated.LastModified = lastModified
+		}
+		slog.Debug("targets metadata has not changed, using cached one",
+			"version", validators.Version, "bytes saved", updated.BytesSaved)
+		if err := r.store.SaveValidators(&updated); err != nil {
+			slog.Warn("failed to update targets metadata validators", "error", err)
+		}
+		return r.loadTargets(cached)
+	}
 	if res.StatusCode != http.StatusOK {
 		return fmt.Errorf("unexpected status code HTTP_%d from %s: %s", res.StatusCode, TargetsResourcePath, res.String())
 	}
@@ -49,16 +94,40 @@ func (r *plainRepo) update() error {
 	if err := res.Json(&targetsFile); err != nil {
 		return fmt.Errorf("failed to unmarshal 'targets.json' received from Device Gateway: %w", err)
 	}
+	// Verify before writing, so the last-known-good file is kept if the verification fails
+	if r.verifier != nil {
+		if err := r.verifier.verify(res.Body, time.Now()); err != nil {
+			return err
+		}
+	}
 
-	if err := os.WriteFile(r.targetsFilepath, res.Body, 0644); err != nil {
-		return fmt.Errorf("failed to write obtained targets to file: %w", err)
+	if err := r.store.Save(res.Body, targetsFile.Signed.Version); err != nil {
+		return err
+	}
+	// Report the bytes saved by the conditional requests made since the previous version was received
+	if validators != nil {
+		r.bytesSaved = validators.BytesSaved
+	}
+	err = r.store.SaveValidators(&Validators{
+		Version:      targetsFile.Signed.Version,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	})
+	if err != nil {
+		slog.Warn("failed to save targets metadata validators", "error", err)
 	}
 	return r.loadTargets(res.Body)
 }
 
-func (r *plainRepo) LoadTargets(update bool) (Targets, int, error) {
+func (r *plainRepo) LoadTargets(ctx context.Context, update bool) (Targets, int, error) {
 	if update {
-		if err := r.update(); err != nil {
+		if r.dgClient == nil {
+			return nil, -1, ErrNoGatewayClient
+		}
+		if r.readOnly {
+			return nil, -1, ErrReadOnlyRepo
+		}
+		if err := r.update(ctx); err != nil {
 			return nil, -1, err
 		}
 	} else {
@@ -69,10 +138,28 @@ func (r *plainRepo) LoadTargets(update bool) (Targets, int, error) {
 	return r.targets, r.version, nil
 }
 
+func (r *plainRepo) MetadataVersions() MetadataVersions {
+	versions := UnknownMetadataVersions
+	versions.Targets = r.version
+	return versions
+}
+
+func (r *plainRepo) DiscardedTargets() []DiscardedTarget {
+	return r.discarded
+}
+
+func (r *plainRepo) BytesSaved() int64 {
+	return r.bytesSaved
+}
+
 func (r *plainRepo) readTargets() error {
-	b, err := os.ReadFile(r.targetsFilepath)
+	load := r.store.Load
+	if r.readOnly {
+		load = r.store.LoadReadOnly
+	}
+	b, err := load()
 	if err != nil {
-		return fmt.Errorf("failed to read targets from file: %w", err)
+		return err
 	}
 	return r.loadTargets(b)
 }
@@ -83,72 +170,18 @@ func (r *plainRepo) loadTargets(targetsData []byte) error {
 		return fmt.Errorf("failed to unmarshal 'targets.json' read from file: %w", err)
 	}
 	r.targets = nil
+	r.discarded = nil
 	for targetName, targetValue := range targetsFile.Signed.Targets {
-		version, err := strconv.Atoi(targetValue.Custom.Version)
-		if err != nil {
-			slog.Debug("invalid value of target version is found", "target custom", targetValue.Custom)
-			continue
-		}
-		if len(targetValue.Custom.HardwareID) == 0 {
-			slog.Debug("target with no hardware ID is found", "target custom", targetValue.Custom)
-			continue
-		}
-		var match bool
-		for _, hwID := range targetValue.Custom.HardwareID {
-			if hwID == r.hardwareID {
-				match = true
-				break
-			}
-		}
-		if !match {
+		// This is an invalid target, continue processing other targets instead of returning an error
+		// since the target file may contain multiple targets and some of them may be valid.
+		t, reason := r.filter.newTarget(targetName, &targetValue.Custom)
+		t.Sha256, t.Length = targetValue.Hashes["sha256"], targetValue.Length
+		if reason != "" {
+			slog.Debug("target is discarded", "target", targetName, "reason", reason)
+			r.discarded = append(r.discarded, DiscardedTarget{Target: t, Reason: reason})
 			continue
 		}
-		var apps []App
-		isValidTarget := true
-		for appName, appField := range targetValue.Custom.Apps {
-			appRef, err := compose.ParseAppRef(appField.URI)
-			if err != nil {
-				slog.Error(
-					"failed to parse app URI in target",
-					"target", targetName,
-					"app", appName,
-					"uri", appField.URI,
-					"error", err,
-				)
-				isValidTarget = false
-				// This is an invalid target, continue processing other targets instead of
-				// returning an error since the target file may contain multiple targets and some of them may be valid.
-				break
-			}
-			// The app name embedded in the URI must match the app name declared
-			// in the target configuration. A mismatch indicates a misconfigured
-			// target. This validation is required because composectl derives the
-			// app name from the URI passed through its CLI or API.
-			if appRef.Name != appName {
-				slog.Error(
-					"app name mismatch between target and URI",
-					"target", targetName,
-					"target_app", appName,
-					"uri_app", appRef.Name,
-					"uri", appField.URI,
-				)
-				isValidTarget = false
-				// This is an invalid target, continue processing other targets instead of
-				// returning an error since the target file may contain multiple targets and some of them may be valid.
-				break
-			}
-			apps = append(apps, App{
-				Name: appName,
-				URI:  appField.URI,
-			})
-		}
-		if isValidTarget {
-			r.targets = append(r.targets, Target{
-				ID:      targetName,
-				Version: version,
-				Apps:    apps,
-			})
-		}
+		r.targets = append(r.targets, t)
 	}
 	r.version = targetsFile.Signed.Version
 	return nil
@@ -0,0 +1,86 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package target
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/foundriesio/fioup/pkg/client"
+	"github.com/foundriesio/fioup/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlainRepo_WithoutGatewayClient(t *testing.T) {
+	targetsFile := filepath.Join(t.TempDir(), "targets.json")
+	require.Nil(t, NewMetadataStore(targetsFile, 0).Save(testTargetsMetadata(3), 3))
+
+	// The stored targets are read without a client, but they cannot be updated
+	repo, err := NewPlainRepo(nil, targetsFile, "intel-corei7-64")
+	require.Nil(t, err)
+	_, version, err := repo.LoadTargets(context.Background(), false)
+	require.Nil(t, err)
+	require.Equal(t, 3, version)
+	_, _, err = repo.LoadTargets(context.Background(), true)
+	require.ErrorIs(t, err, ErrNoGatewayClient)
+
+	// The stored targets are read by a read-only repo without restoring the corrupted targets file
+	require.Nil(t, os.WriteFile(targetsFile, []byte("{"), 0o644))
+	repo, err = NewPlainRepo(nil, targetsFile, "intel-corei7-64", WithReadOnly(true))
+	require.Nil(t, err)
+	_, version, err = repo.LoadTargets(context.Background(), false)
+	require.Nil(t, err)
+	require.Equal(t, 3, version)
+	data, err := os.ReadFile(targetsFile)
+	require.Nil(t, err)
+	require.Equal(t, "{", string(data))
+
+	// The TUF repo cannot be created without a client
+	_, err = NewRepo(&config.Config{}, nil, true)
+	require.ErrorIs(t, err, ErrNoGatewayClient)
+}
+
+func TestPlainRepo_BytesSaved(t *testing.T) {
+	version := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"v` + strconv.Itoa(version) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(testTargetsMetadata(version))
+	}))
+	defer srv.Close()
+	baseURL, err := url.Parse(srv.URL)
+	require.Nil(t, err)
+	gw := &client.GatewayClient{BaseURL: baseURL, HttpClient: srv.Client()}
+	targetsFile := filepath.Join(t.TempDir(), "targets.json")
+	check := func() Repo {
+		// The repo is created anew on each check, e.g. by each run of fioup check
+		repo, err := NewPlainRepo(gw, targetsFile, "intel-corei7-64")
+		require.Nil(t, err)
+		_, _, err = repo.LoadTargets(context.Background(), true)
+		require.Nil(t, err)
+		return repo
+	}
+
+	require.Equal(t, int64(0), check().BytesSaved())
+	// The bytes saved are counted across the checks until a new version is received
+	check()
+	check()
+	store := NewMetadataStore(targetsFile, 0)
+	saved := int64(2 * len(testTargetsMetadata(1)))
+	require.Equal(t, saved, store.Validators().BytesSaved)
+
+	version = 2
+	require.Equal(t, saved, check().BytesSaved())
+	require.Equal(t, &Validators{Version: 2, ETag: `"v2"`}, store.Validators())
+}
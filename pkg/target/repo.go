@@ -3,8 +3,132 @@
 
 package target
 
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	"github.com/foundriesio/fioup/pkg/client"
+	"github.com/foundriesio/fioup/pkg/config"
+)
+
 type (
 	Repo interface {
-		LoadTargets(update bool) (Targets, int, error)
+		LoadTargets(ctx context.Context, update bool) (Targets, int, error)
+		// MetadataVersions returns the versions of the metadata loaded by the last LoadTargets call
+		MetadataVersions() MetadataVersions
+		// DiscardedTargets returns the targets found by the last LoadTargets call that cannot be installed
+		// on the device, along with the reason each of them is discarded
+		DiscardedTargets() []DiscardedTarget
+		// BytesSaved returns the number of metadata bytes not downloaded thanks to the conditional requests
+		// made since the previous version of the metadata was received
+		BytesSaved() int64
+	}
+
+	// MetadataVersions holds the versions of the repo metadata; -1 means that the version is unknown
+	// or that the repo has no such metadata
+	MetadataVersions struct {
+		Root     int `json:"root"`
+		Targets  int `json:"targets"`
+		Snapshot int `json:"snapshot"`
+	}
+
+	RepoOpts struct {
+		// TargetsKeysFile is the pinned TUF root metadata to verify targets.json with; plain repo only
+		TargetsKeysFile string
+		// TargetsHistorySize is the number of previous versions of targets.json kept; plain repo only
+		TargetsHistorySize int
+		// Tags are the tags a target must have one of to be selected
+		Tags []string
+		// Arch is the platform architecture a target must be built for to be selected
+		Arch string
+		// ReadOnly makes the repo not write the stored metadata, e.g. restore it from the history; plain repo only
+		ReadOnly bool
 	}
+	RepoOpt func(*RepoOpts)
 )
+
+var UnknownMetadataVersions = MetadataVersions{Root: -1, Targets: -1, Snapshot: -1}
+
+// WithTargetsKeysFile enables the verification of targets.json received from Device Gateway against
+// the targets role keys of the given pinned TUF root metadata
+func WithTargetsKeysFile(keysFile string) RepoOpt {
+	return func(o *RepoOpts) {
+		o.TargetsKeysFile = keysFile
+	}
+}
+
+// WithTargetsHistorySize sets the number of previous versions of targets.json kept on the local storage
+func WithTargetsHistorySize(size int) RepoOpt {
+	return func(o *RepoOpts) {
+		o.TargetsHistorySize = size
+	}
+}
+
+// WithTags makes the repo select only the targets having one of the given tags
+func WithTags(tags []string) RepoOpt {
+	return func(o *RepoOpts) {
+		o.Tags = tags
+	}
+}
+
+// WithArch makes the repo select only the targets built for the given platform architecture
+func WithArch(arch string) RepoOpt {
+	return func(o *RepoOpts) {
+		o.Arch = arch
+	}
+}
+
+func WithReadOnly(readOnly bool) RepoOpt {
+	return func(o *RepoOpts) {
+		o.ReadOnly = readOnly
+	}
+}
+
+func getRepoOpts(options ...RepoOpt) *RepoOpts {
+	opts := &RepoOpts{TargetsHistorySize: config.TargetsHistorySizeDefault}
+	for _, o := range options {
+		o(opts)
+	}
+	return opts
+}
+
+func (o *RepoOpts) filter(hardwareID string) targetFilter {
+	return targetFilter{hardwareID: hardwareID, tags: o.Tags, arch: o.Arch}
+}
+
+var (
+	ErrNoGatewayClient = errors.New("no Device Gateway client to update the targets metadata with")
+	ErrReadOnlyRepo    = errors.New("the targets metadata of a read-only repo cannot be updated")
+)
+
+// NewRepo returns the repo of the targets available to the device configured by the given config,
+// the given options are applied after the ones of the config
+func NewRepo(cfg *config.Config, dgClient *client.GatewayClient, enableTUF bool, extraOptions ...RepoOpt) (Repo, error) {
+	if enableTUF && dgClient == nil {
+		return nil, ErrNoGatewayClient
+	}
+	options := []RepoOpt{
+		WithTargetsKeysFile(cfg.GetTargetsKeysFile()),
+		WithTargetsHistorySize(cfg.GetTargetsHistorySize()),
+		WithTags(cfg.GetTags()),
+		WithArch(cfg.ComposeConfig().Platform.Architecture),
+	}
+	options = append(options, extraOptions...)
+	if enableTUF {
+		return NewTufRepo(cfg, dgClient, cfg.GetHardwareID(), options...)
+	}
+	return NewPlainRepo(dgClient, cfg.GetTargetsFilepath(), cfg.GetHardwareID(), options...)
+}
+
+// NewStoredRepo returns the repo of the targets stored on the device by the last check, it neither updates
+// nor restores them, so it can be used without the update lock. In the TUF mode, it reads the targets metadata
+// the TUF client has verified and persisted.
+func NewStoredRepo(cfg *config.Config, enableTUF bool) (Repo, error) {
+	targetsFilepath := cfg.GetTargetsFilepath()
+	if enableTUF {
+		targetsFilepath = filepath.Join(TufMetadataDir, "targets.json")
+	}
+	return NewPlainRepo(nil, targetsFilepath, cfg.GetHardwareID(),
+		WithTags(cfg.GetTags()), WithArch(cfg.ComposeConfig().Platform.Architecture), WithReadOnly(true))
+}
@@ -0,0 +1,293 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package target
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/foundriesio/fioconfig/sotatoml"
+)
+
+type (
+	// MetadataStore keeps the targets metadata received from Device Gateway on the local storage.
+	// The current metadata is written atomically to the targets file, and a copy of each version is kept
+	// in the history directory next to it, so a valid copy is available if the targets file gets corrupted.
+	MetadataStore struct {
+		path        string
+		historyDir  string
+		historySize int
+	}
+
+	StoredMetadata struct {
+		Version int       `json:"version"`
+		Path    string    `json:"path"`
+		Size    int64     `json:"size"`
+		SavedAt time.Time `json:"saved_at"`
+		Current bool      `json:"current"`
+		Valid   bool      `json:"valid"`
+	}
+
+	// Validators are the HTTP validators received along with a version of the targets metadata.
+	// They are sent back in a conditional request, so the metadata is not downloaded again if it has not changed.
+	Validators struct {
+		Version      int    `json:"version"`
+		ETag         string `json:"etag,omitempty"`
+		LastModified string `json:"last_modified,omitempty"`
+		// BytesSaved is the size of the metadata not downloaded thanks to the conditional requests
+		// made since this version was received
+		BytesSaved int64 `json:"bytes_saved,omitempty"`
+	}
+)
+
+const (
+	historyDirName    = "targets.d"
+	historyFilePrefix = "targets-"
+	historyFileSuffix = ".json"
+	validatorsFile    = "validators.json"
+)
+
+// NewMetadataStore returns the store of the targets metadata kept in the given targets file.
+// The historySize previous versions are kept in addition to the current one.
+func NewMetadataStore(targetsFilepath string, historySize int) *MetadataStore {
+	return &MetadataStore{
+		path:        targetsFilepath,
+		historyDir:  filepath.Join(filepath.Dir(targetsFilepath), historyDirName),
+		historySize: historySize,
+	}
+}
+
+// Save atomically writes the targets metadata of the given version as the current one,
+// adds it to the history and prunes the history versions beyond the configured limit.
+func (s *MetadataStore) Save(data []byte, version int) error {
+	if err := sotatoml.SafeWrite(s.path, data); err != nil {
+		return fmt.Errorf("failed to write targets metadata: %w", err)
+	}
+	if err := os.MkdirAll(s.historyDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create targets metadata history directory: %w", err)
+	}
+	if err := sotatoml.SafeWrite(s.historyPath(version), data); err != nil {
+		return fmt.Errorf("failed to add targets metadata to history: %w", err)
+	}
+	s.prune(version)
+	return nil
+}
+
+// Load returns the current targets metadata. If the targets file is missing or cannot be parsed
+// then the latest valid version from the history is restored as the current one and returned.
+// An error wrapping os.ErrNotExist is returned if there is no targets metadata at all.
+// The targets file is written by the restore, so the caller must hold the update lock.
+func (s *MetadataStore) Load() ([]byte, error) {
+	return s.load(true)
+}
+
+// LoadReadOnly is Load that does not restore the targets file, the latest valid version from the history
+// is only returned. It is meant for the callers that do not hold the update lock.
+func (s *MetadataStore) LoadReadOnly() ([]byte, error) {
+	return s.load(false)
+}
+
+func (s *MetadataStore) load(restore bool) ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if err == nil {
+		if _, err = parseMetadata(data); err == nil {
+			return data, nil
+		}
+	}
+	loadErr := err
+	history, err := s.history()
+	if err != nil {
+		slog.Warn("failed to list targets metadata history", "error", err)
+	}
+	for _, m := range history {
+		b, err := os.ReadFile(m.Path)
+		if err != nil {
+			continue
+		}
+		if _, err := parseMetadata(b); err != nil {
+			slog.Debug("invalid targets metadata in history", "file", m.Path, "error", err)
+			continue
+		}
+		if !errors.Is(loadErr, os.ErrNotExist) {
+			slog.Warn("failed to load targets metadata, falling back to the last valid version",
+				"file", s.path, "version", m.Version, "error", loadErr)
+		}
+		if restore {
+			if err := sotatoml.SafeWrite(s.path, b); err != nil {
+				slog.Warn("failed to restore targets metadata", "file", s.path, "error", err)
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("failed to load targets metadata: %w", loadErr)
+}
+
+// Get returns the stored targets metadata of the given version
+func (s *MetadataStore) Get(version int) ([]byte, error) {
+	data, err := os.ReadFile(s.historyPath(version))
+	if errors.Is(err, os.ErrNotExist) {
+		// The current metadata may have been saved before the history was introduced
+		if current, readErr := os.ReadFile(s.path); readErr == nil {
+			if currentVersion, parseErr := parseMetadata(current); parseErr == nil && currentVersion == version {
+				return current, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets metadata version %d: %w", version, err)
+	}
+	return data, nil
+}
+
+// List returns the stored versions of the targets metadata, the latest version first.
+// The current metadata is included even if it is not in the history, e.g. if it was saved by aktualizr-lite.
+func (s *MetadataStore) List() ([]StoredMetadata, error) {
+	history, err := s.history()
+	if err != nil {
+		return nil, err
+	}
+	currentVersion := -1
+	if data, err := os.ReadFile(s.path); err == nil {
+		if currentVersion, err = parseMetadata(data); err != nil {
+			currentVersion = -1
+		}
+		if !slices.ContainsFunc(history, func(m StoredMetadata) bool { return m.Version == currentVersion }) {
+			if info, err := os.Stat(s.path); err == nil {
+				history = append([]StoredMetadata{{
+					Version: currentVersion,
+					Path:    s.path,
+					Size:    info.Size(),
+					SavedAt: info.ModTime(),
+				}}, history...)
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read targets metadata: %w", err)
+	}
+	for i := range history {
+		history[i].Current = currentVersion != -1 && history[i].Version == currentVersion
+		if data, err := os.ReadFile(history[i].Path); err == nil {
+			_, err = parseMetadata(data)
+			history[i].Valid = err == nil
+		}
+	}
+	return history, nil
+}
+
+// history returns the versions kept in the history directory, the latest version first
+func (s *MetadataStore) history() ([]StoredMetadata, error) {
+	entries, err := os.ReadDir(s.historyDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var history []StoredMetadata
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, historyFilePrefix) || !strings.HasSuffix(name, historyFileSuffix) {
+			continue
+		}
+		version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, historyFilePrefix), historyFileSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		history = append(history, StoredMetadata{
+			Version: version,
+			Path:    filepath.Join(s.historyDir, name),
+			Size:    info.Size(),
+			SavedAt: info.ModTime(),
+		})
+	}
+	slices.SortFunc(history, func(a, b StoredMetadata) int { return b.Version - a.Version })
+	return history, nil
+}
+
+func (s *MetadataStore) prune(currentVersion int) {
+	history, err := s.history()
+	if err != nil {
+		slog.Warn("failed to list targets metadata history", "error", err)
+		return
+	}
+	// The current version is never removed, and the versions saved last are kept rather than the latest ones
+	// since the version received from the server may go backwards, e.g. if the targets are recreated
+	history = slices.DeleteFunc(history, func(m StoredMetadata) bool { return m.Version == currentVersion })
+	slices.SortStableFunc(history, func(a, b StoredMetadata) int { return b.SavedAt.Compare(a.SavedAt) })
+	for _, m := range history[min(len(history), s.historySize):] {
+		if err := os.Remove(m.Path); err != nil {
+			slog.Warn("failed to remove old targets metadata", "file", m.Path, "error", err)
+		}
+	}
+}
+
+// Validators returns the HTTP validators of the stored targets metadata, or nil if there are none
+func (s *MetadataStore) Validators() *Validators {
+	data, err := os.ReadFile(filepath.Join(s.historyDir, validatorsFile))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Debug("failed to read targets metadata validators", "error", err)
+		}
+		return nil
+	}
+	var v Validators
+	if err := json.Unmarshal(data, &v); err != nil {
+		slog.Debug("failed to parse targets metadata validators", "error", err)
+		return nil
+	}
+	return &v
+}
+
+func (s *MetadataStore) SaveValidators(v *Validators) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.historyDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create targets metadata history directory: %w", err)
+	}
+	if err := sotatoml.SafeWrite(filepath.Join(s.historyDir, validatorsFile), data); err != nil {
+		return fmt.Errorf("failed to write targets metadata validators: %w", err)
+	}
+	return nil
+}
+
+// RequestHeaders returns the headers of a conditional request for the metadata the validators belong to
+func (v *Validators) RequestHeaders() map[string]string {
+	headers := map[string]string{}
+	if v.ETag != "" {
+		headers["If-None-Match"] = v.ETag
+	}
+	if v.LastModified != "" {
+		headers["If-Modified-Since"] = v.LastModified
+	}
+	return headers
+}
+
+func (s *MetadataStore) historyPath(version int) string {
+	return filepath.Join(s.historyDir, historyFilePrefix+strconv.Itoa(version)+historyFileSuffix)
+}
+
+// parseMetadata checks that the data is valid targets metadata and returns its version
+func parseMetadata(data []byte) (int, error) {
+	var targetsFile File
+	if err := json.Unmarshal(data, &targetsFile); err != nil {
+		return -1, err
+	}
+	if targetsFile.Signed.Targets == nil {
+		return -1, errors.New("no targets found in targets metadata")
+	}
+	return targetsFile.Signed.Version, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package target
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testTargetsMetadata(version int) []byte {
+	return fmt.Appendf(nil, `{"signatures":[],"signed":{"version":%d,"targets":{}}}`, version)
+}
+
+func TestMetadataStore_SaveAndPrune(t *testing.T) {
+	targetsFile := filepath.Join(t.TempDir(), "targets.json")
+	store := NewMetadataStore(targetsFile, 2)
+
+	for version := 1; version <= 5; version++ {
+		require.Nil(t, store.Save(testTargetsMetadata(version), version))
+	}
+	data, err := store.Load()
+	require.Nil(t, err)
+	require.Equal(t, testTargetsMetadata(5), data)
+
+	stored, err := store.List()
+	require.Nil(t, err)
+	require.Len(t, stored, 3)
+	for i, m := range stored {
+		require.Equal(t, 5-i, m.Version)
+		require.Equal(t, i == 0, m.Current)
+		require.True(t, m.Valid)
+	}
+	data, err = store.Get(3)
+	require.Nil(t, err)
+	require.Equal(t, testTargetsMetadata(3), data)
+	_, err = store.Get(2)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMetadataStore_PruneVersionGoesBackwards(t *testing.T) {
+	targetsFile := filepath.Join(t.TempDir(), "targets.json")
+	store := NewMetadataStore(targetsFile, 2)
+
+	savedAt := time.Now().Add(-time.Hour)
+	for version := 10; version <= 12; version++ {
+		require.Nil(t, store.Save(testTargetsMetadata(version), version))
+		savedAt = savedAt.Add(time.Minute)
+		require.Nil(t, os.Chtimes(store.historyPath(version), savedAt, savedAt))
+	}
+	// The just saved version is kept even though it is lower than the versions in the history
+	require.Nil(t, store.Save(testTargetsMetadata(1), 1))
+	data, err := store.Get(1)
+	require.Nil(t, err)
+	require.Equal(t, testTargetsMetadata(1), data)
+
+	stored, err := store.List()
+	require.Nil(t, err)
+	var versions []int
+	for _, m := range stored {
+		versions = append(versions, m.Version)
+		require.Equal(t, m.Version == 1, m.Current)
+	}
+	require.Equal(t, []int{12, 11, 1}, versions)
+}
+
+func TestMetadataStore_Fallback(t *testing.T) {
+	targetsFile := filepath.Join(t.TempDir(), "targets.json")
+	store := NewMetadataStore(targetsFile, 3)
+
+	_, err := store.Load()
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// The metadata saved before the history was introduced is loaded as is
+	require.Nil(t, os.WriteFile(targetsFile, testTargetsMetadata(1), 0644))
+	data, err := store.Load()
+	require.Nil(t, err)
+	require.Equal(t, testTargetsMetadata(1), data)
+	data, err = store.Get(1)
+	require.Nil(t, err)
+	require.Equal(t, testTargetsMetadata(1), data)
+
+	require.Nil(t, store.Save(testTargetsMetadata(2), 2))
+	require.Nil(t, store.Save(testTargetsMetadata(3), 3))
+	// The latest version in the history is corrupted as well
+	require.Nil(t, os.WriteFile(store.historyPath(3), testTargetsMetadata(3)[:10], 0644))
+
+	// Truncated file, e.g. after a power cut
+	require.Nil(t, os.WriteFile(targetsFile, testTargetsMetadata(3)[:20], 0644))
+	stored, err := store.List()
+	require.Nil(t, err)
+	require.Len(t, stored, 3)
+	// The corrupted current file is listed too
+	require.Equal(t, targetsFile, stored[0].Path)
+	require.False(t, stored[0].Valid)
+	require.False(t, stored[1].Valid)
+	require.True(t, stored[2].Valid)
+
+	data, err = store.Load()
+	require.Nil(t, err)
+	require.Equal(t, testTargetsMetadata(2), data)
+	// The last valid version is restored as the current one
+	restored, err := os.ReadFile(targetsFile)
+	require.Nil(t, err)
+	require.Equal(t, testTargetsMetadata(2), restored)
+
+	// Missing file
+	require.Nil(t, os.Remove(targetsFile))
+	data, err = store.LoadReadOnly()
+	require.Nil(t, err)
+	require.Equal(t, testTargetsMetadata(2), data)
+	// The read-only load does not restore the file, it is left to the callers holding the update lock
+	require.NoFileExists(t, targetsFile)
+	data, err = store.Load()
+	require.Nil(t, err)
+	require.Equal(t, testTargetsMetadata(2), data)
+	require.FileExists(t, targetsFile)
+}
+
+func TestMetadataStore_Validators(t *testing.T) {
+	store := NewMetadataStore(filepath.Join(t.TempDir(), "targets.json"), 3)
+	require.Nil(t, store.Validators())
+
+	v := &Validators{Version: 2, ETag: `"abc"`, LastModified: "Wed, 21 Oct 2026 07:28:00 GMT"}
+	require.Nil(t, store.SaveValidators(v))
+	require.Equal(t, v, store.Validators())
+	require.Equal(t, map[string]string{
+		"If-None-Match":     `"abc"`,
+		"If-Modified-Since": "Wed, 21 Oct 2026 07:28:00 GMT",
+	}, v.RequestHeaders())
+
+	// The validators file is not listed as a version of the metadata
+	require.Nil(t, store.Save(testTargetsMetadata(2), 2))
+	stored, err := store.List()
+	require.Nil(t, err)
+	require.Len(t, stored, 1)
+	require.Empty(t, (&Validators{Version: 2}).RequestHeaders())
+}
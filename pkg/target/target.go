@@ -9,6 +9,9 @@ import (
 	"os"
 	"slices"
 	"strconv"
+	"time"
+
+	"github.com/foundriesio/composeapp/pkg/compose"
 )
 
 type (
@@ -21,6 +24,11 @@ type (
 		ID      string `json:"id"`
 		Version int    `json:"version"`
 		Apps    []App  `json:"apps"`
+		// Sha256 and Length are the hash and the length of the target file as listed in the targets metadata
+		Sha256 string `json:"sha256,omitempty"`
+		Length int64  `json:"length,omitempty"`
+		// Custom is the raw custom metadata of the target, see the typed accessors for the common fields
+		Custom json.RawMessage `json:"custom,omitempty"`
 	}
 	Targets []Target
 
@@ -33,7 +41,9 @@ type (
 		Version int                 `json:"version"`
 	}
 	Metadata struct {
-		Custom Custom `json:"custom"`
+		Hashes map[string]string `json:"hashes"`
+		Length int64             `json:"length"`
+		Custom Custom            `json:"custom"`
 	}
 	Custom struct {
 		Version string `json:"version"`
@@ -42,6 +52,8 @@ type (
 		} `json:"docker_compose_apps"`
 		Arch       string   `json:"arch"`
 		HardwareID []string `json:"hardwareIds"`
+		// Raw is the whole custom metadata, including the fields not listed above
+		Raw json.RawMessage `json:"-"`
 	}
 )
 
@@ -52,12 +64,96 @@ var (
 	}
 )
 
+func (c *Custom) UnmarshalJSON(data []byte) error {
+	type custom Custom
+	var v custom
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*c = Custom(v)
+	c.Raw = slices.Clone(data)
+	return nil
+}
+
+// CustomValue unmarshals the value of the given key of the target custom metadata into v.
+// It returns false if the key is not found or its value cannot be unmarshalled into v.
+func (t *Target) CustomValue(key string, v any) bool {
+	if len(t.Custom) == 0 {
+		return false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(t.Custom, &fields); err != nil {
+		return false
+	}
+	value, ok := fields[key]
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(value, v); err != nil {
+		slog.Debug("invalid value of target custom field", "target", t.ID, "field", key, "error", err)
+		return false
+	}
+	return true
+}
+
+// Tags returns the tags the target was published with
+func (t *Target) Tags() (tags []string) {
+	t.CustomValue("tags", &tags)
+	return
+}
+
+// Labels returns the labels set on the target, e.g. by CI
+func (t *Target) Labels() (labels map[string]string) {
+	t.CustomValue("labels", &labels)
+	return
+}
+
+// CreatedAt returns the time the target was created at; zero if it is not known
+func (t *Target) CreatedAt() (createdAt time.Time) {
+	t.CustomValue("createdAt", &createdAt)
+	return
+}
+
+// UpdatedAt returns the time the target was last updated at; zero if it is not known
+func (t *Target) UpdatedAt() (updatedAt time.Time) {
+	t.CustomValue("updatedAt", &updatedAt)
+	return
+}
+
+// Arch returns the architecture the target was built for
+func (t *Target) Arch() (arch string) {
+	t.CustomValue("arch", &arch)
+	return
+}
+
+// Digest returns the digest of the app bundle referenced by the app URI; empty if the URI cannot be parsed
+func (a *App) Digest() string {
+	ref, err := compose.ParseAppRef(a.URI)
+	if err != nil {
+		return ""
+	}
+	return ref.Digest.String()
+}
+
+// SameContent returns true if both apps refer to the same app bundle, i.e. they have the same name and digest,
+// even if their URIs are written differently, e.g. the app was re-tagged or moved to another registry.
+func (a *App) SameContent(other *App) bool {
+	if a.Name != other.Name {
+		return false
+	}
+	if a.URI == other.URI {
+		return true
+	}
+	digest := a.Digest()
+	return digest != "" && digest == other.Digest()
+}
+
 func (t *Target) Equals(other *Target) bool {
 	if t.ID != other.ID || t.Version != other.Version || len(t.Apps) != len(other.Apps) {
 		return false
 	}
 	for _, app := range t.Apps {
-		if !slices.ContainsFunc(other.Apps, func(a App) bool { return a.Name == app.Name && a.URI == app.URI }) {
+		if !slices.ContainsFunc(other.Apps, func(a App) bool { return app.SameContent(&a) }) {
 			return false
 		}
 	}
@@ -159,8 +255,8 @@ func (t *Target) Diff(other *Target) (added, removed, same, from, to Apps) {
 		if _, exists := appMap[app.Name]; !exists {
 			added = append(added, app)
 		} else {
-			if app.URI != appMap[app.Name].URI {
-				from = append(from, appMap[app.Name])
+			if fromApp := appMap[app.Name]; !fromApp.SameContent(&app) {
+				from = append(from, fromApp)
 				to = append(to, app)
 			} else {
 				same = append(same, app)
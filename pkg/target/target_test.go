@@ -0,0 +1,93 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package target
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarget_CustomMetadata(t *testing.T) {
+	targetsJson := `{
+  "signatures": [],
+  "signed": {
+    "version": 7,
+    "targets": {
+      "intel-corei7-64-lmp-42": {
+        "custom": {
+          "version": "42",
+          "hardwareIds": ["intel-corei7-64"],
+          "arch": "x86_64",
+          "tags": ["main", "devel"],
+          "labels": {"release": "2026.10"},
+          "createdAt": "2026-10-01T10:00:00Z",
+          "containers-sha": "0123456789abcdef",
+          "docker_compose_apps": {}
+        }
+      }
+    }
+  }
+}`
+	r := &plainRepo{filter: targetFilter{hardwareID: "intel-corei7-64"}}
+	require.Nil(t, r.loadTargets([]byte(targetsJson)))
+	require.Len(t, r.targets, 1)
+	target := r.targets[0]
+
+	require.Equal(t, []string{"main", "devel"}, target.Tags())
+	require.Equal(t, map[string]string{"release": "2026.10"}, target.Labels())
+	require.Equal(t, time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), target.CreatedAt())
+	require.True(t, target.UpdatedAt().IsZero())
+	require.Equal(t, "x86_64", target.Arch())
+	var containersSha string
+	require.True(t, target.CustomValue("containers-sha", &containersSha))
+	require.Equal(t, "0123456789abcdef", containersSha)
+	var missing string
+	require.False(t, target.CustomValue("missing", &missing))
+	// A value of an unexpected type is ignored
+	var version int
+	require.False(t, target.CustomValue("version", &version))
+
+	// The custom metadata is kept when the target is serialized, e.g. to the local DB
+	b, err := json.Marshal(target)
+	require.Nil(t, err)
+	var restored Target
+	require.Nil(t, json.Unmarshal(b, &restored))
+	require.Equal(t, target.Tags(), restored.Tags())
+	require.True(t, target.Equals(&restored))
+}
+
+func TestTarget_DiffByDigest(t *testing.T) {
+	const (
+		digest1 = "sha256:c8087fe1b69ccc025c6cedb8747d98e132d7bf8be8081cb2403ebd3b6545ed6a"
+		digest2 = "sha256:0a3b4fd94e17c0e4c3ffbb79c7ee7d1e7b1d76b7ec4f63e1c3a5b1e1c1fa1b22"
+	)
+	from := Target{ID: "lmp-1", Version: 1, Apps: []App{
+		{Name: "app1", URI: "hub.foundries.io/factory/app1@" + digest1},
+		{Name: "app2", URI: "hub.foundries.io/factory/app2@" + digest1},
+		{Name: "app3", URI: "hub.foundries.io/factory/app3@" + digest1},
+	}}
+	to := Target{ID: "lmp-1", Version: 1, Apps: []App{
+		// Re-tagged app, the same content
+		{Name: "app1", URI: "hub.foundries.io/factory/app1:v1@" + digest1},
+		// The same content in another registry
+		{Name: "app2", URI: "registry.example.com/factory/app2@" + digest1},
+		// New content
+		{Name: "app3", URI: "hub.foundries.io/factory/app3@" + digest2},
+	}}
+
+	added, removed, same, updateFrom, updateTo := from.Diff(&to)
+	require.Empty(t, added)
+	require.Empty(t, removed)
+	require.ElementsMatch(t, []string{"app1", "app2"}, same.Names())
+	require.Equal(t, []string{"app3"}, updateFrom.Names())
+	require.Equal(t, digest1, updateFrom[0].Digest())
+	require.Equal(t, digest2, updateTo[0].Digest())
+	require.False(t, from.Equals(&to))
+
+	to.Apps[2].URI = "hub.foundries.io/factory/app3:v2@" + digest1
+	require.True(t, from.Equals(&to))
+}
@@ -4,12 +4,14 @@
 package target
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"strconv"
+	"os"
+	"path/filepath"
 
-	"github.com/foundriesio/composeapp/pkg/compose"
 	"github.com/foundriesio/fiotuf/tuf"
 	"github.com/foundriesio/fioup/pkg/client"
 	"github.com/foundriesio/fioup/pkg/config"
@@ -17,37 +19,43 @@ import (
 
 type (
 	tufRepo struct {
-		dgClient   *client.GatewayClient
-		tufClient  *tuf.FioTuf
-		targets    Targets
-		hardwareID string
-		// TODO: implement fetching targets version from "tuf.FioTuf"
-		version int
+		dgClient  *client.GatewayClient
+		tufClient *tuf.FioTuf
+		targets   Targets
+		discarded []DiscardedTarget
+		filter    targetFilter
+		versions  MetadataVersions
 	}
 )
 
-func NewTufRepo(cfg *config.Config, dgClient *client.GatewayClient, hardwareID string) (Repo, error) {
-	tufClient, err := tuf.NewFioTuf(cfg.TomlConfig(), dgClient.HttpClient)
+const (
+	// TufMetadataDir is the directory the TUF client persists the trusted metadata to
+	TufMetadataDir = "/var/sota/tuf"
+)
+
+func NewTufRepo(cfg *config.Config, dgClient *client.GatewayClient, hardwareID string, options ...RepoOpt) (Repo, error) {
+	opts := getRepoOpts(options...)
+	// The TUF client makes requests to the Device Gateway on its own, make it send the device headers
+	tufClient, err := tuf.NewFioTuf(cfg.TomlConfig(), dgClient.HttpClientWithHeaders())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TUF HttpClient to talk to TUF repo: %w", err)
 	}
 	return &tufRepo{
-		dgClient:   dgClient,
-		tufClient:  tufClient,
-		hardwareID: hardwareID,
+		dgClient:  dgClient,
+		tufClient: tufClient,
+		filter:    opts.filter(hardwareID),
+		versions:  UnknownMetadataVersions,
 	}, nil
 }
 
 func (r *tufRepo) update() error {
-	// We need to figure out the way set headers (r.dgClient.Headers) to r.tufClient, so it adds
-	// headers we need to the requests it makes to DG
 	if err := r.tufClient.RefreshTuf(""); err != nil {
 		return fmt.Errorf("failed to update TUF metadata: %w", err)
 	}
 	return r.loadTargets()
 }
 
-func (r *tufRepo) LoadTargets(update bool) (Targets, int, error) {
+func (r *tufRepo) LoadTargets(_ context.Context, update bool) (Targets, int, error) {
 	if update {
 		if err := r.update(); err != nil {
 			return nil, -1, err
@@ -57,11 +65,25 @@ func (r *tufRepo) LoadTargets(update bool) (Targets, int, error) {
 			return nil, -1, err
 		}
 	}
-	return r.targets, r.version, nil
+	return r.targets, r.versions.Targets, nil
+}
+
+func (r *tufRepo) MetadataVersions() MetadataVersions {
+	return r.versions
+}
+
+func (r *tufRepo) DiscardedTargets() []DiscardedTarget {
+	return r.discarded
+}
+
+func (r *tufRepo) BytesSaved() int64 {
+	return 0
 }
 
 func (r *tufRepo) loadTargets() error {
+	r.loadVersions()
 	r.targets = nil
+	r.discarded = nil
 	for id, targetValue := range r.tufClient.GetTargets() {
 		var targetDetails Custom
 		var b []byte
@@ -69,75 +91,64 @@ func (r *tufRepo) loadTargets() error {
 		err := json.Unmarshal(b, &targetDetails)
 		if err != nil {
 			slog.Debug("invalid value of target custom field is found", "target custom", targetValue)
+			r.discarded = append(r.discarded, DiscardedTarget{
+				Target: Target{ID: id, Version: -1},
+				Reason: fmt.Sprintf("invalid custom metadata: %s", err),
+			})
 			continue
 		}
-
-		if len(targetDetails.HardwareID) == 0 {
-			slog.Debug("target with no hardware ID is found", "target custom", targetValue)
-			continue
-		}
-		var match bool
-		for _, hwID := range targetDetails.HardwareID {
-			if hwID == r.hardwareID {
-				match = true
-				break
-			}
+		// This is an invalid target, continue processing other targets instead of returning an error
+		// since the target file may contain multiple targets and some of them may be valid.
+		t, reason := r.filter.newTarget(id, &targetDetails)
+		if hash, ok := targetValue.Hashes["sha256"]; ok {
+			t.Sha256 = hash.String()
 		}
-		if !match {
-			continue
-		}
-		version, err := strconv.Atoi(targetDetails.Version)
-		if err != nil {
-			slog.Debug("invalid value of target version is found", "target custom", targetValue)
+		t.Length = targetValue.Length
+		if reason != "" {
+			slog.Debug("target is discarded", "target", id, "reason", reason)
+			r.discarded = append(r.discarded, DiscardedTarget{Target: t, Reason: reason})
 			continue
 		}
+		r.targets = append(r.targets, t)
+	}
+	return nil
+}
 
-		var apps []App
-		isValidTarget := true
-		for appName, appField := range targetDetails.Apps {
-			appRef, err := compose.ParseAppRef(appField.URI)
-			if err != nil {
-				slog.Error(
-					"failed to parse app URI in target",
-					"target", id,
-					"app", appName,
-					"uri", appField.URI,
-					"error", err,
-				)
-				isValidTarget = false
-				// This is an invalid target, continue processing other targets instead of
-				// returning an error since the target file may contain multiple targets and some of them may be valid.
-				break
-			}
-			// The app name embedded in the URI must match the app name declared
-			// in the target configuration. A mismatch indicates a misconfigured
-			// target. This validation is required because composectl derives the
-			// app name from the URI passed through its CLI or API.
-			if appRef.Name != appName {
-				slog.Error(
-					"app name mismatch between target and URI",
-					"target", id,
-					"target_app", appName,
-					"uri_app", appRef.Name,
-					"uri", appField.URI,
-				)
-				isValidTarget = false
-				// This is an invalid target, continue processing other targets instead of
-				// returning an error since the target file may contain multiple targets and some of them may be valid.
-				break
-			}
-			apps = append(apps, App{
-				Name: appName,
-				URI:  appField.URI,
-			})
-		}
-		if isValidTarget {
-			r.targets = append(r.targets, Target{
-				ID:      id,
-				Version: version,
-				Apps:    apps,
-			})
+func (r *tufRepo) loadVersions() {
+	// The TUF client exposes the trusted root only, the versions of the other metadata
+	// are read from the metadata it persisted after verification
+	r.versions = ReadTufMetadataVersions(TufMetadataDir)
+	if root := r.tufClient.GetRoot(); root != nil {
+		r.versions.Root = int(root.Signed.Version)
+	}
+}
+
+// ReadTufMetadataVersions returns the versions of the TUF metadata stored in the given directory.
+// The version of the metadata that is missing or cannot be parsed is set to -1.
+func ReadTufMetadataVersions(dir string) MetadataVersions {
+	return MetadataVersions{
+		Root:     readTufMetadataVersion(filepath.Join(dir, "root.json")),
+		Targets:  readTufMetadataVersion(filepath.Join(dir, "targets.json")),
+		Snapshot: readTufMetadataVersion(filepath.Join(dir, "snapshot.json")),
+	}
+}
+
+func readTufMetadataVersion(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Debug("failed to read TUF metadata", "file", path, "error", err)
 		}
+		return -1
 	}
-	return nil
+	var meta struct {
+		Signed struct {
+			Version int `json:"version"`
+		} `json:"signed"`
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		slog.Debug("failed to parse TUF metadata", "file", path, "error", err)
+		return -1
+	}
+	return meta.Signed.Version
 }
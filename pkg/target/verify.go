@@ -0,0 +1,53 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package target
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+type (
+	// targetsVerifier verifies the signatures of targets.json against the targets role keys
+	// of a locally pinned TUF root metadata
+	targetsVerifier struct {
+		root *metadata.Metadata[metadata.RootType]
+	}
+)
+
+var (
+	ErrTargetsVerificationFailed = errors.New("targets metadata verification failed")
+)
+
+func newTargetsVerifier(keysFile string) (*targetsVerifier, error) {
+	root, err := metadata.Root().FromFile(keysFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pinned root metadata from %s: %w", keysFile, err)
+	}
+	role, ok := root.Signed.Roles[metadata.TARGETS]
+	if !ok || len(role.KeyIDs) == 0 {
+		return nil, fmt.Errorf("no targets role keys found in pinned root metadata %s", keysFile)
+	}
+	return &targetsVerifier{root: root}, nil
+}
+
+// verify checks that the targets metadata is signed by the threshold of the pinned targets keys
+// and that it has not expired at the given time
+func (v *targetsVerifier) verify(targetsData []byte, now time.Time) error {
+	targets, err := metadata.Targets().FromBytes(targetsData)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTargetsVerificationFailed, err)
+	}
+	if err := v.root.VerifyDelegate(metadata.TARGETS, targets); err != nil {
+		return fmt.Errorf("%w: %w", ErrTargetsVerificationFailed, err)
+	}
+	if targets.Signed.IsExpired(now) {
+		return fmt.Errorf("%w: version %d expired at %s", ErrTargetsVerificationFailed,
+			targets.Signed.Version, targets.Signed.Expires.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) Qualcomm Technologies, Inc. and/or its subsidiaries.
+// SPDX-License-Identifier: BSD-3-Clause-Clear
+
+package target
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/require"
+	"github.com/theupdateframework/go-tuf/v2/metadata"
+)
+
+func newTestSigner(t *testing.T) (*signature.ED25519Signer, *metadata.Key) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	signer, err := signature.LoadED25519Signer(priv)
+	require.Nil(t, err)
+	key, err := metadata.KeyFromPublicKey(pub)
+	require.Nil(t, err)
+	return signer, key
+}
+
+func newTestTargets(t *testing.T, expires time.Time, signers ...signature.Signer) []byte {
+	t.Helper()
+	targets := metadata.Targets(expires)
+	targets.Signed.Version = 42
+	custom := json.RawMessage(`{"version":"42","hardwareIds":["intel-corei7-64"],"docker_compose_apps":{}}`)
+	targets.Signed.Targets["intel-corei7-64-lmp-42"] = &metadata.TargetFiles{
+		Length: 1,
+		Hashes: metadata.Hashes{"sha256": make([]byte, 32)},
+		Custom: &custom,
+	}
+	for _, signer := range signers {
+		_, err := targets.Sign(signer)
+		require.Nil(t, err)
+	}
+	b, err := targets.ToBytes(false)
+	require.Nil(t, err)
+	return b
+}
+
+func TestTargetsVerifier(t *testing.T) {
+	signer, key := newTestSigner(t)
+	otherSigner, _ := newTestSigner(t)
+
+	root := metadata.Root(time.Now().Add(time.Hour))
+	require.Nil(t, root.Signed.AddKey(key, metadata.TARGETS))
+	keysFile := filepath.Join(t.TempDir(), "root.json")
+	require.Nil(t, root.ToFile(keysFile, false))
+
+	verifier, err := newTargetsVerifier(keysFile)
+	require.Nil(t, err)
+	now := time.Now()
+
+	require.Nil(t, verifier.verify(newTestTargets(t, now.Add(time.Hour), signer), now))
+	// Signed by a key that is not pinned
+	require.ErrorIs(t, verifier.verify(newTestTargets(t, now.Add(time.Hour), otherSigner), now), ErrTargetsVerificationFailed)
+	// Not signed at all
+	require.ErrorIs(t, verifier.verify(newTestTargets(t, now.Add(time.Hour)), now), ErrTargetsVerificationFailed)
+	// Expired
+	require.ErrorIs(t, verifier.verify(newTestTargets(t, now.Add(-time.Hour), signer), now), ErrTargetsVerificationFailed)
+
+	// Tampered with after signing
+	var f map[string]any
+	require.Nil(t, json.Unmarshal(newTestTargets(t, now.Add(time.Hour), signer), &f))
+	f["signed"].(map[string]any)["version"] = 43
+	tampered, err := json.Marshal(f)
+	require.Nil(t, err)
+	require.ErrorIs(t, verifier.verify(tampered, now), ErrTargetsVerificationFailed)
+
+	// The pinned root without targets keys cannot be used
+	require.Nil(t, root.Signed.RevokeKey(key.ID(), metadata.TARGETS))
+	require.Nil(t, root.ToFile(keysFile, false))
+	_, err = newTargetsVerifier(keysFile)
+	require.NotNil(t, err)
+}
@@ -1,6 +1,7 @@
 package integration_tests
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -18,7 +19,7 @@ type mockHttpOperations struct {
 	proxyHandler func() (*transport.HttpRes, error)
 }
 
-func (o mockHttpOperations) HttpGet(client *http.Client, url string, headers map[string]string) (*transport.HttpRes, error) {
+func (o mockHttpOperations) HttpGet(ctx context.Context, client *http.Client, url string, headers map[string]string) (*transport.HttpRes, error) {
 	err := os.MkdirAll(o.tempDir+"/http_get", 0o700)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create http_get dir: %w", err)
@@ -41,7 +42,7 @@ func (o mockHttpOperations) HttpGet(client *http.Client, url string, headers map
 
 var postedEvents []events.DgUpdateEvent
 
-func (o mockHttpOperations) HttpDo(client *http.Client, method, url string, headers map[string]string, data any) (*transport.HttpRes, error) {
+func (o mockHttpOperations) HttpDo(ctx context.Context, client *http.Client, method, url string, headers map[string]string, data any) (*transport.HttpRes, error) {
 	// fmt.Print("HttpDo " + method + " " + url + "\n")
 	if method == http.MethodPost {
 		if strings.HasSuffix(url, "/events") {